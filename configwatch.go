@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pageConfigMu serializes every page config load, so a slow load of older
+// files can't be swapped in after a newer one and a reload is checked
+// against the other page sets as they are.
+var pageConfigMu sync.Mutex
+
+// pageConfigLoader returns the function that loads the page config at path
+// into registry. check, when set, is handed a copy of registry serving the
+// new pages and can reject them. A config that doesn't load or is rejected
+// leaves the pages the registry already has in place.
+func pageConfigLoader(registry *pageRegistry, path string, check func(*pageRegistry) error) func() error {
+	return func() error {
+		pageConfigMu.Lock()
+		defer pageConfigMu.Unlock()
+		routes, err := loadPageConfig(path)
+		if err != nil {
+			return err
+		}
+		if check != nil {
+			candidate, err := registry.withConfigRoutes(routes)
+			if err != nil {
+				return err
+			}
+			if err := check(candidate); err != nil {
+				return err
+			}
+		}
+		if err := registry.setConfigRoutes(routes); err != nil {
+			return err
+		}
+		log.Printf("page config: serving %d pages from %s", len(routes), path)
+		return nil
+	}
+}
+
+// watchPageConfigReloads calls load for the page config at path, named by
+// what in the log, on SIGHUP and, when poll is positive, whenever its files
+// change
+func watchPageConfigReloads(what, path string, poll time.Duration, load func() error) {
+	watchReloadSignal(what, load)
+	if poll > 0 {
+		watchPageConfig(path, poll, load)
+	}
+}
+
+// pageConfigStamp sums up the names, sizes and modification times of the
+// config files at path and of the scripts and programs their pages use so
+// that comparing two stamps tells whether anything was added, removed or
+// changed in between.
+func pageConfigStamp(path string) (string, error) {
+	files, err := pageConfigFiles(path)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "%s %d %d\n", file, info.Size(), info.ModTime().UnixNano())
+		for _, dep := range pageConfigDeps(file) {
+			// a missing script is a change too, the reload reports it
+			if info, err := os.Stat(dep); err == nil {
+				fmt.Fprintf(&b, "%s %d %d\n", dep, info.Size(), info.ModTime().UnixNano())
+			} else {
+				fmt.Fprintf(&b, "%s missing\n", dep)
+			}
+		}
+	}
+	return b.String(), nil
+}
+
+// pageConfigDeps returns the script files and exec programs the pages of
+// the config file use, resolved the way compilePage resolves them. A file
+// that doesn't parse has none, loading it reports what is wrong with it.
+func pageConfigDeps(file string) []string {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil
+	}
+	var config struct {
+		Pages []struct {
+			Exec   *execDef   `yaml:"exec"`
+			Script *scriptDef `yaml:"script"`
+		} `yaml:"pages"`
+	}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil
+	}
+	dir := filepath.Dir(file)
+	var deps []string
+	for _, def := range config.Pages {
+		dep := ""
+		switch {
+		case def.Script != nil && def.Script.File != "":
+			dep = def.Script.File
+		case def.Exec != nil && strings.Contains(def.Exec.Command, "/"):
+			// programs looked up in PATH aren't ours to watch
+			dep = def.Exec.Command
+		default:
+			continue
+		}
+		if !filepath.IsAbs(dep) {
+			dep = filepath.Join(dir, dep)
+		}
+		deps = append(deps, dep)
+	}
+	return deps
+}
+
+// watchPageConfig checks the config files at path every interval and calls
+// load when they changed. Failed loads are logged and not retried until the
+// files change again so a broken file is reported once, not every interval.
+func watchPageConfig(path string, interval time.Duration, load func() error) {
+	last, err := pageConfigStamp(path)
+	if err != nil {
+		log.Printf("page config: can't watch %s: %v", path, err)
+	}
+	go func() {
+		for range time.Tick(interval) {
+			stamp, err := pageConfigStamp(path)
+			if err != nil {
+				if last != "" {
+					log.Printf("page config: can't read %s, keeping the current pages: %v", path, err)
+				}
+				last = ""
+				continue
+			}
+			if stamp == last {
+				continue
+			}
+			last = stamp
+			if err := load(); err != nil {
+				log.Printf("page config: rejected changes to %s, keeping the current pages: %v", path, err)
+			}
+		}
+	}()
+}
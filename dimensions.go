@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	pb "github.com/rendicott/uggly"
+)
+
+// maxClientDimension is the largest width or height a client may ask for.
+// Pages lay out boxes in proportion to the client size so anything bigger
+// is far more likely to be a broken client than a real terminal.
+const maxClientDimension = 10000
+
+// validateDimensions rejects client sizes no terminal can have before any
+// page gets to compute box geometry from them.
+func validateDimensions(preq *pb.PageRequest) error {
+	width, height := preq.ClientWidth, preq.ClientHeight
+	if width < 0 || height < 0 {
+		return errInvalidInput("The client size %dx%d is negative.", width, height)
+	}
+	if width > maxClientDimension || height > maxClientDimension {
+		return errInvalidInput("The client size %dx%d is larger than %dx%d.",
+			width, height, maxClientDimension, maxClientDimension)
+	}
+	return nil
+}
+
+// fits reports whether the client is at least as large as the route's
+// declared minimum size.
+func (r *pageRoute) fits(preq *pb.PageRequest) bool {
+	return int(preq.ClientWidth) >= r.minWidth && int(preq.ClientHeight) >= r.minHeight
+}
+
+// enlargeTerminalPage is sent instead of a page when the client is smaller
+// than the page's minimum size. It is a single unbordered box so it still
+// shows something useful on the tiniest of terminals and the client will
+// request the page again once it is resized.
+func enlargeTerminalPage(preq *pb.PageRequest, minWidth, minHeight int) *pb.PageResponse {
+	localPage := pb.PageResponse{
+		Name:     preq.Name,
+		DivBoxes: &pb.DivBoxes{},
+		Elements: &pb.Elements{},
+	}
+	localPage.DivBoxes.Boxes = append(localPage.DivBoxes.Boxes, &pb.DivBox{
+		Name:     "enlarge",
+		Border:   false,
+		FillChar: convertStringCharRune(""),
+		StartX:   0,
+		StartY:   0,
+		Width:    preq.ClientWidth,
+		Height:   preq.ClientHeight,
+		FillSt:   shelp("white", "black"),
+	})
+	localPage.Elements.TextBlobs = append(localPage.Elements.TextBlobs, &pb.TextBlob{
+		Content: fmt.Sprintf("please enlarge your terminal (need %dx%d, have %dx%d)",
+			minWidth, minHeight, preq.ClientWidth, preq.ClientHeight),
+		Wrap:     true,
+		Style:    shelp("orange", "black"),
+		DivNames: []string{"enlarge"},
+	})
+	return &localPage
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	pb "github.com/rendicott/uggly"
+)
+
+// elixirRoute serves the page of a single elixir by its Id
+const elixirRoute = "elixir/{id}"
+
+// elixirPageRoute serves the pages after the first of an elixir's wizard menu
+const elixirPageRoute = "elixir/{id}/page/{n}"
+
+// elixirsRoute serves the index of every elixir any wizard is known for
+const elixirsRoute = "elixirs"
+
+// elixirsPageRoute serves the pages after the first of the elixir index
+const elixirsPageRoute = "elixirs/page/{n}"
+
+// elixirs lists every elixir from the wizard data by name with a keystroke
+// to open its page.
+func elixirs(ctx context.Context, preq *pb.PageRequest) (presp *pb.PageResponse, err error) {
+	menuPage, err := parseMenuPage(routeParam(ctx, "n"))
+	if err != nil {
+		return nil, err
+	}
+	index, err := loadWizardIndex(ctx)
+	if err != nil {
+		return presp, err
+	}
+	height := int(preq.ClientHeight)
+	width := int(preq.ClientWidth)
+	localPage := pb.PageResponse{
+		Name:     preq.Name,
+		DivBoxes: &pb.DivBoxes{},
+		Elements: &pb.Elements{},
+	}
+	localPage.DivBoxes.Boxes = append(localPage.DivBoxes.Boxes, &pb.DivBox{
+		Name:       "elixirs",
+		Border:     true,
+		BorderW:    int32(1),
+		BorderChar: convertStringCharRune("^"),
+		FillChar:   convertStringCharRune(""),
+		StartX:     2,
+		StartY:     1,
+		Width:      int32(atLeast(width-4, 1)),
+		Height:     int32(atLeast(height-2, 1)),
+		BorderSt:   shelp("grey", "black"),
+		FillSt:     shelp("white", "black"),
+	})
+	var items []menuItem
+	for _, elixir := range index.elixirs {
+		link, err := pages.link(elixirRoute, map[string]string{"id": elixir.Id})
+		if err != nil {
+			return presp, err
+		}
+		items = append(items, menuItem{
+			label: orUnknown(elixir.Name),
+			link:  link,
+		})
+	}
+	// borders, the title and the pager take up eight rows
+	elixirMenu := newMenu(items, menuKeys(), height-8, routePageLink(elixirsPageRoute, nil))
+	menuContent, err := elixirMenu.render(&localPage, menuPage)
+	if err != nil {
+		return presp, err
+	}
+	localPage.Elements.TextBlobs = append(localPage.Elements.TextBlobs, &pb.TextBlob{
+		Content:  fmt.Sprintf("ELIXIRS (%d)\n\n", len(index.elixirs)) + menuContent,
+		Wrap:     true,
+		Style:    shelp("white", "black"),
+		DivNames: []string{"elixirs"},
+	})
+	return &localPage, err
+}
+
+// elixirDetail shows every field of an elixir and links to each wizard the
+// reverse index associates with it.
+func elixirDetail(ctx context.Context, preq *pb.PageRequest) (presp *pb.PageResponse, err error) {
+	id := routeParam(ctx, "id")
+	menuPage, err := parseMenuPage(routeParam(ctx, "n"))
+	if err != nil {
+		return nil, err
+	}
+	index, err := loadWizardIndex(ctx)
+	if err != nil {
+		return presp, err
+	}
+	elixir, ok := index.elixirByID[id]
+	if !ok {
+		return nil, errNotFound("There is no elixir with the id '%s'.", id)
+	}
+	var items []menuItem
+	for _, wizard := range index.elixirWizards[id] {
+		link, err := pages.link(wizardRoute, map[string]string{"id": wizard.Id})
+		if err != nil {
+			return presp, err
+		}
+		items = append(items, menuItem{
+			label: wizard.fullName(),
+			link:  link,
+		})
+	}
+	// the wizards are listed below the seven lines of elixir details
+	wizardMenu := newMenu(items, menuKeys(detailPageKeys...), int(preq.ClientHeight)-22,
+		routePageLink(elixirPageRoute, map[string]string{"id": id}))
+	links := &pb.PageResponse{}
+	menuContent, err := wizardMenu.render(links, menuPage)
+	if err != nil {
+		return presp, err
+	}
+	body := elixirDetails(*elixir) + "\nWIZARDS\n\n" + menuContent
+	localPage := detailPage(preq, orUnknown(elixir.Name), elixirsRoute, "back to elixirs", body)
+	localPage.KeyStrokes = append(localPage.KeyStrokes, links.KeyStrokes...)
+	return localPage, err
+}
+
+func init() {
+	pages.register(&pageRoute{
+		pattern:     elixirsRoute,
+		handler:     elixirs,
+		listed:      true,
+		description: "Every elixir the wizards are known for",
+		category:    "wizards",
+		order:       1,
+		minWidth:    40,
+		minHeight:   12,
+	})
+	pages.register(&pageRoute{pattern: elixirsPageRoute, handler: elixirs, minWidth: 40, minHeight: 12})
+	// the wizards menu starts below the elixir details 22 rows down
+	pages.register(&pageRoute{pattern: elixirRoute, handler: elixirDetail, minWidth: 40, minHeight: 26})
+	pages.register(&pageRoute{pattern: elixirPageRoute, handler: elixirDetail, minWidth: 40, minHeight: 26})
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	pb "github.com/rendicott/uggly"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"log"
+)
+
+// errorKind is the category of a pageError. Each kind maps to a gRPC status
+// code and to the title of the error page sent along with it so clients can
+// tell a bad request apart from a server that is having trouble.
+type errorKind int
+
+const (
+	errKindNotFound errorKind = iota + 1
+	errKindInvalidInput
+	errKindUpstream
+	errKindUnauthorized
+)
+
+// code is the gRPC status code errors of this kind are answered with
+func (k errorKind) code() codes.Code {
+	switch k {
+	case errKindNotFound:
+		return codes.NotFound
+	case errKindInvalidInput:
+		return codes.InvalidArgument
+	case errKindUpstream:
+		return codes.Unavailable
+	case errKindUnauthorized:
+		return codes.Unauthenticated
+	}
+	return codes.Internal
+}
+
+// title heads the error page sent for errors of this kind
+func (k errorKind) title() string {
+	switch k {
+	case errKindNotFound:
+		return "PAGE NOT FOUND"
+	case errKindInvalidInput:
+		return "INVALID REQUEST"
+	case errKindUpstream:
+		return "SERVICE UNAVAILABLE"
+	case errKindUnauthorized:
+		return "ACCESS DENIED"
+	}
+	return "INTERNAL ERROR"
+}
+
+// pageError is an error a page handler returns when it knows why it can't
+// serve a page. msg is shown to the user so it should make sense to them,
+// the optional cause is only logged.
+type pageError struct {
+	kind  errorKind
+	msg   string
+	cause error
+}
+
+func (e *pageError) Error() string {
+	if e.cause != nil {
+		return fmt.Sprintf("%s: %v", e.msg, e.cause)
+	}
+	return e.msg
+}
+
+func (e *pageError) Unwrap() error {
+	return e.cause
+}
+
+// errNotFound is for pages or things on them that don't exist
+func errNotFound(format string, a ...interface{}) error {
+	return &pageError{kind: errKindNotFound, msg: fmt.Sprintf(format, a...)}
+}
+
+// errInvalidInput is for requests that can never be served as sent
+func errInvalidInput(format string, a ...interface{}) error {
+	return &pageError{kind: errKindInvalidInput, msg: fmt.Sprintf(format, a...)}
+}
+
+// errUpstream is for failures of something the server depends on, like the
+// wizard source, that may well go away when the client tries again
+func errUpstream(cause error, format string, a ...interface{}) error {
+	return &pageError{kind: errKindUpstream, msg: fmt.Sprintf(format, a...), cause: cause}
+}
+
+// errUnauthorized is for pages the peer hasn't proven it may see
+func errUnauthorized(format string, a ...interface{}) error {
+	return &pageError{kind: errKindUnauthorized, msg: fmt.Sprintf(format, a...)}
+}
+
+// requestIDOrNew returns the request ID of ctx or makes one up for when the
+// requestid interceptor is turned off, so errors can always be quoted.
+func requestIDOrNew(ctx context.Context) string {
+	if id := requestID(ctx); id != "" {
+		return id
+	}
+	return newRequestID()
+}
+
+// pageErrorStatus turns the error a page handler returned into the status
+// GetPage answers with. A pageError gets the status code and error page of
+// its kind, an error that already is a gRPC status is passed on unchanged
+// and anything else is treated as a bug and reported as Internal.
+func pageErrorStatus(ctx context.Context, preq *pb.PageRequest, err error) error {
+	var perr *pageError
+	if errors.As(err, &perr) {
+		if perr.cause != nil {
+			log.Printf("request %s page '%s': %v", requestID(ctx), preq.Name, err)
+		}
+		return pageStatus(perr.kind.code(), errorPage(ctx, preq, perr.kind.title(), perr.msg), "%s", perr.msg)
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	id := requestIDOrNew(ctx)
+	log.Printf("request %s page '%s' failed: %v", id, preq.Name, err)
+	return pageStatus(codes.Internal, internalErrorPage(ctx, preq, id), "internal error in request %s", id)
+}
+
+// errorPage builds a small bordered page with a title and a message that
+// is used whenever the server has to explain why it can't serve a request.
+// It always has a keystroke back to the home page of the client's site so
+// the user isn't stuck.
+func errorPage(ctx context.Context, preq *pb.PageRequest, title, msg string) *pb.PageResponse {
+	site, _ := siteFor(ctx)
+	localPage := messagePage(preq, title, msg+"\n\n  (h) back home", shelp("red", "black"))
+	localPage.KeyStrokes = append(localPage.KeyStrokes, &pb.KeyStroke{
+		KeyStroke: "h",
+		Action: &pb.KeyStroke_Link{
+			Link: localLink(site.home(pages)),
+		}})
+	return localPage
+}
+
+// messagePage builds a page with a single bordered box in the middle of the
+// client's screen holding a title and a message.
+func messagePage(preq *pb.PageRequest, title, msg string, borderSt *pb.Style) *pb.PageResponse {
+	// error pages are also sent for requests with sizes validateDimensions rejects
+	width := atLeast(int(preq.ClientWidth), 0)
+	height := atLeast(int(preq.ClientHeight), 0)
+	boxWidth := width - width/4
+	boxHeight := height - height/2
+	localPage := pb.PageResponse{
+		Name:     preq.Name,
+		DivBoxes: &pb.DivBoxes{},
+		Elements: &pb.Elements{},
+	}
+	localPage.DivBoxes.Boxes = append(localPage.DivBoxes.Boxes, &pb.DivBox{
+		Name:       "message",
+		Border:     true,
+		BorderW:    int32(1),
+		BorderChar: convertStringCharRune("*"),
+		FillChar:   convertStringCharRune(""),
+		StartX:     int32(width/2 - boxWidth/2),
+		StartY:     int32(height/2 - boxHeight/2),
+		Width:      int32(boxWidth),
+		Height:     int32(boxHeight),
+		BorderSt:   borderSt,
+		FillSt:     shelp("white", "black"),
+	})
+	localPage.Elements.TextBlobs = append(localPage.Elements.TextBlobs, &pb.TextBlob{
+		Content:  fmt.Sprintf("  %s\n\n  %s\n", title, msg),
+		Wrap:     true,
+		Style:    shelp("white", "black"),
+		DivNames: []string{"message"},
+	})
+	return &localPage
+}
+
+// internalErrorPage is the errorPage sent when building a page panicked or
+// failed for a reason nobody anticipated. It shows the request ID so the
+// user can quote it when reporting the problem.
+func internalErrorPage(ctx context.Context, preq *pb.PageRequest, id string) *pb.PageResponse {
+	return errorPage(ctx, preq, "INTERNAL ERROR",
+		fmt.Sprintf("Something went wrong building the page '%s'. Request ID: %s", preq.Name, id))
+}
+
+// pageStatus builds a gRPC status error with the given code and attaches
+// page to its details so that clients which understand it can still render
+// something friendlier than the bare status message.
+func pageStatus(code codes.Code, page *pb.PageResponse, format string, a ...interface{}) error {
+	st := status.Newf(code, format, a...)
+	if page != nil {
+		if detailed, err := st.WithDetails(page); err == nil {
+			st = detailed
+		}
+	}
+	return st.Err()
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	pb "github.com/rendicott/uggly"
+	"google.golang.org/protobuf/encoding/protojson"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// execDef is a page config entry that hands the page to an executable,
+// the CGI of uggly. The PageRequest is written to the program's stdin as
+// protobuf JSON and the program writes the PageResponse to its stdout the
+// same way. The main parts of the request are also in UGGLY_* environment
+// variables, see execEnv, so simple scripts don't need to parse JSON.
+//
+// A relative command containing a "/" is relative to the directory of the
+// config file, which is also the program's working directory.
+type execDef struct {
+	Command string        `yaml:"command"`
+	Args    []string      `yaml:"args"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// execRunner runs the programs of exec pages. slots limits how many run at
+// once across every exec page and timeout is used for pages without one.
+type execRunner struct {
+	slots   chan struct{}
+	timeout time.Duration
+}
+
+// execPages is the runner every exec page uses, main sets it from flags
+var execPages = newExecRunner(4, 5*time.Second)
+
+func newExecRunner(concurrency int, timeout time.Duration) *execRunner {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &execRunner{
+		slots:   make(chan struct{}, concurrency),
+		timeout: timeout,
+	}
+}
+
+// execPage is a compiled execDef
+type execPage struct {
+	name    string
+	command string
+	args    []string
+	dir     string
+	timeout time.Duration
+}
+
+// newExecPage checks the command of an exec page whose config lives in dir
+func newExecPage(name string, def execDef, dir string) (*execPage, error) {
+	if def.Command == "" {
+		return nil, fmt.Errorf("page '%s': exec needs a command", name)
+	}
+	command := def.Command
+	if strings.Contains(command, "/") && !filepath.IsAbs(command) {
+		// absolute because it would otherwise be taken relative to dir twice
+		abs, err := filepath.Abs(filepath.Join(dir, command))
+		if err != nil {
+			return nil, fmt.Errorf("page '%s': %v", name, err)
+		}
+		command = abs
+	}
+	if _, err := exec.LookPath(command); err != nil {
+		return nil, fmt.Errorf("page '%s': %v", name, err)
+	}
+	if def.Timeout < 0 {
+		return nil, fmt.Errorf("page '%s': negative exec timeout", name)
+	}
+	return &execPage{
+		name:    name,
+		command: command,
+		args:    def.Args,
+		dir:     dir,
+		timeout: def.Timeout,
+	}, nil
+}
+
+// envName turns a cookie or parameter name into the end of an environment
+// variable name, anything but letters and digits becomes "_".
+func envName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' {
+			return r - 'a' + 'A'
+		}
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// execEnvPassed are the variables of the server's own environment its
+// programs get, the rest of it may hold secrets pages have no business with
+var execEnvPassed = []string{"PATH", "HOME", "LANG"}
+
+// execEnv is the environment of the program serving preq: execEnvPassed
+// plus UGGLY_PAGE, UGGLY_WIDTH, UGGLY_HEIGHT, UGGLY_REQUEST_ID, the peer's
+// verified UGGLY_CLIENT_NAME if there is one and UGGLY_PARAM_<NAME>,
+// UGGLY_COOKIE_<KEY> and UGGLY_FORM_<FIELD> for every route parameter,
+// cookie and form field. A value with a NUL byte can't be put in the
+// environment so the request is rejected as invalid input.
+func execEnv(ctx context.Context, preq *pb.PageRequest) ([]string, error) {
+	var env []string
+	for _, name := range execEnvPassed {
+		if val, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+val)
+		}
+	}
+	env = append(env,
+		"UGGLY_PAGE="+preq.Name,
+		"UGGLY_WIDTH="+strconv.Itoa(int(preq.ClientWidth)),
+		"UGGLY_HEIGHT="+strconv.Itoa(int(preq.ClientHeight)),
+		"UGGLY_REQUEST_ID="+requestID(ctx),
+	)
+	if identity, ok := peerIdentity(ctx); ok {
+		env = append(env, "UGGLY_CLIENT_NAME="+identity.name())
+	}
+	for name, val := range routeParams(ctx) {
+		env = append(env, "UGGLY_PARAM_"+envName(name)+"="+val)
+	}
+	for _, cookie := range preq.SendCookies {
+		env = append(env, "UGGLY_COOKIE_"+envName(cookie.Key)+"="+cookie.Value)
+	}
+	for _, fd := range preq.FormData {
+		for _, td := range fd.TextBoxData {
+			env = append(env, "UGGLY_FORM_"+envName(td.Name)+"="+td.Contents)
+		}
+	}
+	for _, kv := range env {
+		if strings.IndexByte(kv, 0) >= 0 {
+			return nil, errInvalidInput("The page '%s' can't be sent a value with a NUL byte in it.", preq.Name)
+		}
+	}
+	return env, nil
+}
+
+// serve runs the page's program for preq. It waits for a free slot for as
+// long as the page may run and reports a busy or slow program as an
+// upstream error. A program that fails or writes something that isn't a
+// PageResponse is a broken page and reported as a plain error.
+func (p *execPage) serve(ctx context.Context, preq *pb.PageRequest) (*pb.PageResponse, error) {
+	runner := execPages
+	timeout := p.timeout
+	if timeout == 0 {
+		timeout = runner.timeout
+	}
+	env, err := execEnv(ctx, preq)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	select {
+	case runner.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, errUpstream(ctx.Err(), "The page '%s' is too busy right now, try again in a bit.", preq.Name)
+	}
+	stdin, err := protojson.Marshal(preq)
+	if err != nil {
+		<-runner.slots
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, p.command, p.args...)
+	cmd.Dir = p.dir
+	cmd.Env = env
+	cmd.Stdin = bytes.NewReader(stdin)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	done := make(chan error, 1)
+	go func() {
+		// the slot is only freed once the program is really gone, even
+		// when it outlives the request by holding on to its output
+		defer func() { <-runner.slots }()
+		done <- cmd.Run()
+	}()
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		return nil, errUpstream(ctx.Err(), "The page '%s' took too long, try again in a bit.", preq.Name)
+	}
+	if ctx.Err() != nil {
+		return nil, errUpstream(ctx.Err(), "The page '%s' took too long, try again in a bit.", preq.Name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("exec page '%s': %s: %v: %s", p.name, p.command, err, strings.TrimSpace(stderr.String()))
+	}
+	presp := &pb.PageResponse{}
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(stdout.Bytes(), presp); err != nil {
+		return nil, fmt.Errorf("exec page '%s': %s wrote no PageResponse: %v", p.name, p.command, err)
+	}
+	if presp.Name == "" {
+		presp.Name = preq.Name
+	}
+	return presp, nil
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"errors"
+	pb "github.com/rendicott/uggly"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeScript writes an executable shell script to dir
+func writeScript(t *testing.T, dir, name, body string) {
+	t.Helper()
+	if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+body), 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testExecPage compiles an exec page for a script in a fresh directory
+func testExecPage(t *testing.T, body string, timeout time.Duration) *execPage {
+	t.Helper()
+	dir := t.TempDir()
+	writeScript(t, dir, "page.sh", body)
+	p, err := newExecPage("test", execDef{Command: "./page.sh", Timeout: timeout}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestEnvName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"name", "NAME"},
+		{"userId", "USERID"},
+		{"first-name", "FIRST_NAME"},
+		{"a.b c", "A_B_C"},
+		{"x9", "X9"},
+	}
+	for _, tt := range tests {
+		if got := envName(tt.name); got != tt.want {
+			t.Errorf("envName('%s') = '%s', want '%s'", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNewExecPage(t *testing.T) {
+	dir := t.TempDir()
+	writeScript(t, dir, "page.sh", "exit 0\n")
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		def     execDef
+		wantErr bool
+	}{
+		{execDef{Command: "./page.sh"}, false},
+		{execDef{Command: "sh"}, false},
+		{execDef{Command: filepath.Join(dir, "page.sh")}, false},
+		{execDef{}, true},
+		{execDef{Command: "./missing.sh"}, true},
+		{execDef{Command: "./sub"}, true},
+		{execDef{Command: "./page.sh", Timeout: -time.Second}, true},
+	}
+	for _, tt := range tests {
+		p, err := newExecPage("test", tt.def, dir)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("newExecPage(%+v) error = %v, want error %v", tt.def, err, tt.wantErr)
+			continue
+		}
+		if err == nil && strings.HasPrefix(tt.def.Command, "./") && !filepath.IsAbs(p.command) {
+			t.Errorf("newExecPage(%+v) left the command relative: '%s'", tt.def, p.command)
+		}
+	}
+}
+
+// TestExecPageRequest checks what the program gets to see of the request
+func TestExecPageRequest(t *testing.T) {
+	p := testExecPage(t, `
+cat >/dev/null
+text="$UGGLY_PAGE $UGGLY_WIDTH $UGGLY_HEIGHT $UGGLY_PARAM_WHO $UGGLY_COOKIE_NAME $UGGLY_FORM_AGE"
+printf '{"elements": {"textBlobs": [{"content": "%s"}]}, "futureField": 1}' "$text"
+`, 0)
+	preq := &pb.PageRequest{
+		Name:         "hello/bob",
+		ClientWidth:  80,
+		ClientHeight: 24,
+		SendCookies:  []*pb.Cookie{{Key: "name", Value: "Ada"}},
+		FormData:     []*pb.FormData{{Name: "f", TextBoxData: []*pb.TextBoxData{{Name: "age", Contents: "36"}}}},
+	}
+	ctx := withRouteParams(context.Background(), map[string]string{"who": "bob"})
+	presp, err := p.serve(ctx, preq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := presp.Elements.TextBlobs[0].Content, "hello/bob 80 24 bob Ada 36"; got != want {
+		t.Errorf("content '%s', want '%s'", got, want)
+	}
+	if presp.Name != "hello/bob" {
+		t.Errorf("name '%s', want the request's name", presp.Name)
+	}
+}
+
+// TestExecPageStdin checks that the PageRequest arrives as JSON on stdin
+func TestExecPageStdin(t *testing.T) {
+	p := testExecPage(t, `
+name=$(sed -n 's/.*"name": *"\([^"]*\)".*/\1/p')
+printf '{"name": "echo-%s"}' "$name"
+`, 0)
+	presp, err := p.serve(context.Background(), &pb.PageRequest{Name: "clock"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if presp.Name != "echo-clock" {
+		t.Errorf("name '%s', want 'echo-clock'", presp.Name)
+	}
+}
+
+func TestExecPageFailures(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		timeout  time.Duration
+		upstream bool
+	}{
+		{"exit status", "echo broken >&2; exit 3\n", 0, false},
+		{"not json", "echo hello\n", 0, false},
+		{"too slow", "sleep 5\n", 100 * time.Millisecond, true},
+	}
+	for _, tt := range tests {
+		p := testExecPage(t, tt.body, tt.timeout)
+		start := time.Now()
+		_, err := p.serve(context.Background(), &pb.PageRequest{Name: "test"})
+		if err == nil {
+			t.Errorf("%s: no error", tt.name)
+			continue
+		}
+		var perr *pageError
+		if upstream := errors.As(err, &perr) && perr.kind == errKindUpstream; upstream != tt.upstream {
+			t.Errorf("%s: upstream error = %v, want %v: %v", tt.name, upstream, tt.upstream, err)
+		}
+		if time.Since(start) > 2*time.Second {
+			t.Errorf("%s: took %v", tt.name, time.Since(start))
+		}
+	}
+}
+
+// TestExecPageBusy checks that a request waiting for a slot longer than
+// the page may run is turned away as an upstream error
+func TestExecPageBusy(t *testing.T) {
+	saved := execPages
+	defer func() { execPages = saved }()
+	execPages = newExecRunner(1, time.Second)
+	execPages.slots <- struct{}{}
+	defer func() { <-execPages.slots }()
+	p := testExecPage(t, "echo '{}'\n", 100*time.Millisecond)
+	_, err := p.serve(context.Background(), &pb.PageRequest{Name: "test"})
+	var perr *pageError
+	if !errors.As(err, &perr) || perr.kind != errKindUpstream {
+		t.Errorf("busy runner gave %v, want an upstream error", err)
+	}
+}
+
+// TestExecPageEnv checks that programs only get the allowed part of the
+// server's environment
+func TestExecPageEnv(t *testing.T) {
+	os.Setenv("UGGDYN_TEST_SECRET", "hunter2")
+	defer os.Unsetenv("UGGDYN_TEST_SECRET")
+	env, err := execEnv(context.Background(), &pb.PageRequest{Name: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, kv := range env {
+		name := kv[:strings.Index(kv, "=")]
+		if strings.HasPrefix(name, "UGGLY_") {
+			continue
+		}
+		allowed := false
+		for _, passed := range execEnvPassed {
+			allowed = allowed || name == passed
+		}
+		if !allowed {
+			t.Errorf("program gets '%s' from the server's environment", name)
+		}
+	}
+	if !strings.Contains(strings.Join(env, "\n"), "PATH=") && os.Getenv("PATH") != "" {
+		t.Errorf("program doesn't get PATH")
+	}
+}
+
+func TestExecPageNUL(t *testing.T) {
+	p := testExecPage(t, "echo '{}'\n", 0)
+	tests := []*pb.PageRequest{
+		{Name: "test", SendCookies: []*pb.Cookie{{Key: "name", Value: "A\x00da"}}},
+		{Name: "test", FormData: []*pb.FormData{{TextBoxData: []*pb.TextBoxData{{Name: "age", Contents: "3\x006"}}}}},
+		{Name: "te\x00st"},
+	}
+	for _, preq := range tests {
+		_, err := p.serve(context.Background(), preq)
+		var perr *pageError
+		if !errors.As(err, &perr) || perr.kind != errKindInvalidInput {
+			t.Errorf("request %v gave %v, want invalid input", preq, err)
+		}
+	}
+}
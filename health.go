@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"log"
+	"time"
+)
+
+// healthServices are the services whose health is reported, "" being the
+// server as a whole
+var healthServices = []string{"", "uggly.Feed", "uggly.Page"}
+
+// sourceHealthChecker is implemented by wizard sources that can tell if
+// their upstream is healthy without being asked for the wizards directly
+type sourceHealthChecker interface {
+	healthCheck(ctx context.Context) error
+}
+
+// checkSourceHealth reports whether the wizard source can currently serve
+func checkSourceHealth(ctx context.Context, source wizardSource) error {
+	if checker, ok := source.(sourceHealthChecker); ok {
+		return checker.healthCheck(ctx)
+	}
+	_, err := source.Wizards(ctx)
+	return err
+}
+
+// setServingStatus reports status for every service in healthServices
+func setServingStatus(hs *health.Server, status healthpb.HealthCheckResponse_ServingStatus) {
+	for _, service := range healthServices {
+		hs.SetServingStatus(service, status)
+	}
+}
+
+// updateSourceHealth checks the wizard source once, giving it at most
+// timeout when that is positive, and reports the outcome on hs
+func updateSourceHealth(hs *health.Server, source wizardSource, timeout time.Duration) {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	if err := checkSourceHealth(ctx, source); err != nil {
+		log.Printf("health: wizard source unhealthy: %v", err)
+		setServingStatus(hs, healthpb.HealthCheckResponse_NOT_SERVING)
+		return
+	}
+	setServingStatus(hs, healthpb.HealthCheckResponse_SERVING)
+}
+
+// watchSourceHealth checks the wizard source every interval and reports
+// the server NOT_SERVING while it is unhealthy. Once hs has been shut down
+// for draining any status set here is ignored so draining always wins.
+func watchSourceHealth(hs *health.Server, source wizardSource, interval, timeout time.Duration) {
+	go func() {
+		updateSourceHealth(hs, source, timeout)
+		for range time.Tick(interval) {
+			updateSourceHealth(hs, source, timeout)
+		}
+	}()
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// servingStatus returns what hs reports for the server as a whole
+func servingStatus(t *testing.T, hs *health.Server) healthpb.HealthCheckResponse_ServingStatus {
+	t.Helper()
+	resp, err := hs.Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.Status
+}
+
+// testWizardAPI answers every request with status and counts requests by method
+func testWizardAPI(t *testing.T, status int) (*httptest.Server, map[string]int) {
+	t.Helper()
+	methods := make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods[r.Method]++
+		w.WriteHeader(status)
+		w.Write([]byte("[]"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, methods
+}
+
+func TestUpdateSourceHealth(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		timeout time.Duration
+		want    healthpb.HealthCheckResponse_ServingStatus
+	}{
+		{"ok", http.StatusOK, time.Second, healthpb.HealthCheckResponse_SERVING},
+		// no timeout means no deadline, not an instant one
+		{"no timeout", http.StatusOK, 0, healthpb.HealthCheckResponse_SERVING},
+		{"HEAD not routed", http.StatusMethodNotAllowed, 0, healthpb.HealthCheckResponse_SERVING},
+		{"server error", http.StatusServiceUnavailable, time.Second, healthpb.HealthCheckResponse_NOT_SERVING},
+	}
+	for _, tt := range tests {
+		api, methods := testWizardAPI(t, tt.status)
+		hs := health.NewServer()
+		updateSourceHealth(hs, newHTTPWizardSource(api.URL, tt.timeout), tt.timeout)
+		if got := servingStatus(t, hs); got != tt.want {
+			t.Errorf("%s: status %v, want %v", tt.name, got, tt.want)
+		}
+		if methods[http.MethodGet] != 0 {
+			t.Errorf("%s: the health check fetched the wizard list", tt.name)
+		}
+	}
+}
+
+func TestUpdateSourceHealthUnreachable(t *testing.T) {
+	api, _ := testWizardAPI(t, http.StatusOK)
+	api.Close()
+	hs := health.NewServer()
+	updateSourceHealth(hs, newHTTPWizardSource(api.URL, 0), 0)
+	if got := servingStatus(t, hs); got != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("unreachable API: status %v, want NOT_SERVING", got)
+	}
+}
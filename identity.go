@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	pb "github.com/rendicott/uggly"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"strings"
+)
+
+// clientIdentity is who a peer proved to be with a client certificate that
+// was verified against -client_ca_file.
+type clientIdentity struct {
+	subject string
+	sans    []string
+}
+
+// name is how handlers should address the peer: the common name of the
+// certificate subject or, lacking one, its first subject alternative name.
+func (id *clientIdentity) name() string {
+	if id.subject != "" {
+		return id.subject
+	}
+	if len(id.sans) > 0 {
+		return id.sans[0]
+	}
+	return "unknown"
+}
+
+// subjectAltNames collects every kind of SAN a certificate can carry
+func subjectAltNames(cert *x509.Certificate) []string {
+	var sans []string
+	sans = append(sans, cert.DNSNames...)
+	sans = append(sans, cert.EmailAddresses...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		sans = append(sans, uri.String())
+	}
+	return sans
+}
+
+// peerIdentity returns the identity of the peer behind ctx. It only reports
+// ok when the TLS handshake verified the peer's certificate chain so an
+// unverified or missing certificate is never mistaken for an identity.
+func peerIdentity(ctx context.Context) (*clientIdentity, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.AuthInfo == nil {
+		return nil, false
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+		return nil, false
+	}
+	leaf := tlsInfo.State.VerifiedChains[0][0]
+	return &clientIdentity{
+		subject: leaf.Subject.CommonName,
+		sans:    subjectAltNames(leaf),
+	}, true
+}
+
+// whoami shows the peer the identity the server verified for it. The route
+// requires a verified peer but the handler doesn't count on that, a peer
+// without one is told so instead of crashing the call.
+func whoami(ctx context.Context, preq *pb.PageRequest) (presp *pb.PageResponse, err error) {
+	identity, ok := peerIdentity(ctx)
+	if !ok || identity == nil {
+		return nil, errUnauthorized("The page '%s' is only served to clients with a verified certificate.", preq.Name)
+	}
+	sans := strings.Join(identity.sans, ", ")
+	if sans == "" {
+		sans = "none"
+	}
+	msg := fmt.Sprintf("Subject: %s\n  Alternative names: %s", orUnknown(identity.subject), sans)
+	return messagePage(preq, "YOUR CERTIFICATE", msg, shelp("springgreen", "black")), err
+}
+
+func init() {
+	pages.register(&pageRoute{
+		pattern:     "whoami",
+		handler:     whoami,
+		listed:      true,
+		description: "Shows the identity of your verified client certificate",
+		category:    "demo",
+		order:       3,
+		requireAuth: true,
+		minWidth:    40,
+		minHeight:   10,
+	})
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	pb "github.com/rendicott/uggly"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"strings"
+	"testing"
+)
+
+// verifiedPeer is a context whose peer verified cert over TLS
+func verifiedPeer(cert *x509.Certificate) context.Context {
+	state := tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	return peer.NewContext(context.Background(), &peer.Peer{AuthInfo: credentials.TLSInfo{State: state}})
+}
+
+func TestWhoami(t *testing.T) {
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{"subject", verifiedPeer(&x509.Certificate{Subject: pkix.Name{CommonName: "ada"}, DNSNames: []string{"ada.example"}}),
+			"Subject: ada\n  Alternative names: ada.example"},
+		{"no names", verifiedPeer(&x509.Certificate{}), "Alternative names: none"},
+	}
+	preq := &pb.PageRequest{Name: "whoami", ClientWidth: 80, ClientHeight: 24}
+	for _, tt := range tests {
+		presp, err := whoami(tt.ctx, preq)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if content := presp.Elements.TextBlobs[0].Content; !strings.Contains(content, tt.want) {
+			t.Errorf("%s: '%s' missing from\n%s", tt.name, tt.want, content)
+		}
+	}
+}
+
+// TestWhoamiUnverified checks that whoami turns away peers without a
+// verified certificate instead of panicking
+func TestWhoamiUnverified(t *testing.T) {
+	preq := &pb.PageRequest{Name: "whoami", ClientWidth: 80, ClientHeight: 24}
+	unverified := peer.NewContext(context.Background(), &peer.Peer{AuthInfo: credentials.TLSInfo{}})
+	for _, ctx := range []context.Context{context.Background(), unverified} {
+		_, err := whoami(ctx, preq)
+		var perr *pageError
+		if !errors.As(err, &perr) || perr.kind != errKindUnauthorized {
+			t.Errorf("unverified peer gave %v, want unauthorized", err)
+		}
+	}
+}
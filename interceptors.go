@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	pb "github.com/rendicott/uggly"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"log"
+	"regexp"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// requestIDKey is the metadata key request IDs are read from and sent back on
+const requestIDKey = "x-request-id"
+
+// validRequestID limits which client supplied request IDs are trusted
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// requestIDCtxKey is the context key the request ID is stored under
+type requestIDCtxKey struct{}
+
+// requestID returns the ID of the request behind ctx, if it was given one
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDCtxKey{}).(string)
+	return id
+}
+
+// newRequestID makes a random request ID
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// requestIDInterceptor gives every call a request ID. A well formed ID sent
+// by the client is kept so calls can be traced across servers, otherwise a
+// new one is made. The ID is sent back to the client as a header.
+func requestIDInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+	id := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if vals := md.Get(requestIDKey); len(vals) > 0 && validRequestID.MatchString(vals[0]) {
+			id = vals[0]
+		}
+	}
+	if id == "" {
+		id = newRequestID()
+	}
+	grpc.SetHeader(ctx, metadata.Pairs(requestIDKey, id))
+	return handler(context.WithValue(ctx, requestIDCtxKey{}, id), req)
+}
+
+// pageNameOf returns the page a call asked for or "-" for calls that aren't
+// a PageRequest
+func pageNameOf(req interface{}) string {
+	if preq, ok := req.(*pb.PageRequest); ok {
+		return fmt.Sprintf("'%s'", preq.Name)
+	}
+	return "-"
+}
+
+// loggingInterceptor logs one line per call with the request ID, method,
+// requested page, resulting status code and latency. Only those fields are
+// logged so nothing a client puts in its metadata or cookies ends up in logs.
+func loggingInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	id := requestID(ctx)
+	if id == "" {
+		id = "-"
+	}
+	log.Printf("request %s %s page %s: %s in %s", id, info.FullMethod, pageNameOf(req),
+		status.Code(err), time.Since(start).Round(time.Microsecond))
+	return resp, err
+}
+
+// timingInterceptor tells the client how long the server spent on a call in
+// a server-timing trailer.
+func timingInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	elapsed := float64(time.Since(start).Microseconds()) / 1000
+	grpc.SetTrailer(ctx, metadata.Pairs("server-timing", fmt.Sprintf("total;dur=%.3f", elapsed)))
+	return resp, err
+}
+
+// recoveryInterceptor turns a panic in a handler into an Internal status for
+// that call instead of letting it take down the whole server. A panic while
+// building a page also gets an internal error page in the status details.
+func recoveryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (resp interface{}, err error) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		id := requestIDOrNew(ctx)
+		log.Printf("request %s %s panicked: %v\n%s", id, info.FullMethod, r, debug.Stack())
+		var page *pb.PageResponse
+		if preq, ok := req.(*pb.PageRequest); ok {
+			page = internalErrorPage(ctx, preq, id)
+		}
+		resp, err = nil, pageStatus(codes.Internal, page, "internal error in request %s", id)
+	}()
+	return handler(ctx, req)
+}
+
+// interceptorOrder is every interceptor that can be turned on with the
+// -interceptors flag in the order they wrap a call, outermost first. Request
+// IDs come first so everything else can use them and recovery comes last so
+// the others see a recovered panic as an ordinary error. Interceptors that
+// are always on are installed whether they are listed or not, without
+// recovery a single panicking page would take the whole server down.
+var interceptorOrder = []struct {
+	name        string
+	interceptor grpc.UnaryServerInterceptor
+	alwaysOn    bool
+}{
+	{"requestid", requestIDInterceptor, false},
+	{"logging", loggingInterceptor, false},
+	{"timing", timingInterceptor, false},
+	{"recovery", recoveryInterceptor, true},
+}
+
+// unaryInterceptors returns the interceptors named in the comma separated
+// list and those that are always on, always in interceptorOrder regardless
+// of the order they're listed in.
+func unaryInterceptors(list string) ([]grpc.UnaryServerInterceptor, error) {
+	enabled := make(map[string]bool)
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		known := false
+		for _, ic := range interceptorOrder {
+			if ic.name == name {
+				known = true
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown interceptor '%s'", name)
+		}
+		enabled[name] = true
+	}
+	var chain []grpc.UnaryServerInterceptor
+	for _, ic := range interceptorOrder {
+		if enabled[ic.name] || ic.alwaysOn {
+			chain = append(chain, ic.interceptor)
+		}
+	}
+	return chain, nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	pb "github.com/rendicott/uggly"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+)
+
+func TestUnaryInterceptors(t *testing.T) {
+	tests := []struct {
+		list    string
+		count   int
+		wantErr bool
+	}{
+		{"requestid,logging,timing,recovery", 4, false},
+		{"timing, requestid", 3, false},
+		// recovery is installed even when it isn't listed
+		{"logging", 2, false},
+		{"", 1, false},
+		{"logging,nope", 0, true},
+	}
+	for _, tt := range tests {
+		chain, err := unaryInterceptors(tt.list)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("unaryInterceptors('%s') error = %v, want error %v", tt.list, err, tt.wantErr)
+			continue
+		}
+		if len(chain) != tt.count {
+			t.Errorf("unaryInterceptors('%s') has %d interceptors, want %d", tt.list, len(chain), tt.count)
+		}
+	}
+}
+
+// TestRecoveryAlwaysOn checks that a panicking page is answered with an
+// error page even when recovery isn't listed
+func TestRecoveryAlwaysOn(t *testing.T) {
+	chain, err := unaryInterceptors("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	panicking := func(ctx context.Context, req interface{}) (interface{}, error) {
+		panic("broken page")
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/uggly.Page/GetPage"}
+	preq := &pb.PageRequest{Name: "broken", ClientWidth: 80, ClientHeight: 24}
+	_, err = chain[len(chain)-1](context.Background(), preq, info, panicking)
+	st := status.Convert(err)
+	if st.Code() != codes.Internal {
+		t.Fatalf("panicking page gave %v, want Internal", err)
+	}
+	found := false
+	for _, detail := range st.Details() {
+		_, found = detail.(*pb.PageResponse)
+	}
+	if !found {
+		t.Errorf("Internal status carries no error page")
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	pb "github.com/rendicott/uggly"
+	"strconv"
+)
+
+// serverAddress is where a client can reach an uggly server
+type serverAddress struct {
+	host   string
+	port   string
+	secure bool
+}
+
+// selfAddress is the public address of this server that links are built
+// with by default. It is set from the -public_* flags and when no public
+// host is configured it stays empty so links leave Server and Port unset
+// and clients stay on whatever server they are already talking to.
+var selfAddress serverAddress
+
+// newSelfAddress builds the public address from the -public_* flags. A
+// public host without a port means the port the server listens on.
+func newSelfAddress(host, port string, secure bool, listenPort int) serverAddress {
+	if host != "" && port == "" {
+		port = strconv.Itoa(listenPort)
+	}
+	return serverAddress{
+		host:   host,
+		port:   port,
+		secure: secure,
+	}
+}
+
+// link returns a Link to pageName on this address
+func (a serverAddress) link(pageName string) *pb.Link {
+	return &pb.Link{
+		PageName: pageName,
+		Server:   a.host,
+		Port:     a.port,
+		Secure:   a.secure,
+	}
+}
+
+// localLink returns a Link to a page on this server
+func localLink(pageName string) *pb.Link {
+	return selfAddress.link(pageName)
+}
+
+// link returns a Link to the page the route registered under pattern serves
+// for params on this server.
+func (r *pageRegistry) link(pattern string, params map[string]string) (*pb.Link, error) {
+	name, err := r.pageName(pattern, params)
+	if err != nil {
+		return nil, err
+	}
+	return localLink(name), nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// listenFlag collects every -listen flag given on the command line
+type listenFlag []string
+
+func (l *listenFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listenFlag) Set(addr string) error {
+	*l = append(*l, addr)
+	return nil
+}
+
+var listenAddrs listenFlag
+
+func init() {
+	flag.Var(&listenAddrs, "listen", "Address to serve on, repeatable. Either TCP 'host:port', 'unix:/path/to.sock' "+
+		"or 'systemd' for the sockets passed in by systemd socket activation. Defaults to 127.0.0.1:<port>, "+
+		"or to 'systemd' when the process was socket activated")
+}
+
+// systemdListenFDsStart is the first file descriptor systemd passes sockets on
+const systemdListenFDsStart = 3
+
+// socketActivated reports whether systemd passed sockets to this process
+func socketActivated() bool {
+	return os.Getenv("LISTEN_PID") == strconv.Itoa(os.Getpid()) && os.Getenv("LISTEN_FDS") != ""
+}
+
+// systemdListeners turns the sockets systemd passed to this process into
+// listeners. The LISTEN_* variables are cleared afterwards so that child
+// processes don't think the sockets were meant for them. If one of the
+// sockets can't be used every one of them is closed, turned into a
+// listener already or not.
+func systemdListeners() ([]net.Listener, error) {
+	if !socketActivated() {
+		return nil, fmt.Errorf("'systemd' listen address given but the process wasn't socket activated")
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count < 1 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS '%s'", os.Getenv("LISTEN_FDS"))
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+	defer os.Unsetenv("LISTEN_FDNAMES")
+	var listeners []net.Listener
+	for i := 0; i < count; i++ {
+		name := fmt.Sprintf("LISTEN_FD_%d", systemdListenFDsStart+i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		f := os.NewFile(uintptr(systemdListenFDsStart+i), name)
+		lis, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			for _, lis := range listeners {
+				lis.Close()
+			}
+			for j := i + 1; j < count; j++ {
+				os.NewFile(uintptr(systemdListenFDsStart+j), "").Close()
+			}
+			return nil, fmt.Errorf("inherited socket '%s': %v", name, err)
+		}
+		listeners = append(listeners, lis)
+	}
+	return listeners, nil
+}
+
+// listenUnix listens on a unix socket, removing a socket left behind by a
+// previous run first. Anything at the path that isn't a socket is left alone.
+func listenUnix(path string) (net.Listener, error) {
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	return net.Listen("unix", path)
+}
+
+// openListeners opens a listener for every address. If any of them fails
+// the ones already opened, inherited systemd sockets included, are closed
+// again so a failed start doesn't leave sockets or socket files behind.
+func openListeners(addrs []string) ([]net.Listener, error) {
+	var listeners []net.Listener
+	for _, addr := range addrs {
+		var opened []net.Listener
+		var err error
+		switch {
+		case addr == "systemd":
+			opened, err = systemdListeners()
+		case strings.HasPrefix(addr, "unix:"):
+			var lis net.Listener
+			lis, err = listenUnix(strings.TrimPrefix(addr, "unix:"))
+			opened = append(opened, lis)
+		default:
+			var lis net.Listener
+			lis, err = net.Listen("tcp", addr)
+			opened = append(opened, lis)
+		}
+		if err != nil {
+			for _, lis := range listeners {
+				lis.Close()
+			}
+			return nil, fmt.Errorf("listen on '%s': %v", addr, err)
+		}
+		listeners = append(listeners, opened...)
+	}
+	return listeners, nil
+}
+
+// defaultListenAddrs is what the server listens on without any -listen flag
+func defaultListenAddrs(port int) []string {
+	if socketActivated() {
+		return []string{"systemd"}
+	}
+	return []string{fmt.Sprintf("127.0.0.1:%d", port)}
+}
+
+// serveAll calls serve for every listener and returns once all of them
+// have stopped cleanly or as soon as one of them fails.
+func serveAll(serve func(net.Listener) error, listeners []net.Listener) error {
+	errs := make(chan error, len(listeners))
+	for _, lis := range listeners {
+		log.Printf("Server listening on %s %s", lis.Addr().Network(), lis.Addr())
+		go func(lis net.Listener) {
+			errs <- serve(lis)
+		}(lis)
+	}
+	for range listeners {
+		if err := <-errs; err != nil {
+			return err
+		}
+	}
+	return nil
+}
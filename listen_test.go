@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenListeners(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "uggdyn.sock")
+	listeners, err := openListeners([]string{"127.0.0.1:0", "unix:" + sock})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		for _, lis := range listeners {
+			lis.Close()
+		}
+	}()
+	if len(listeners) != 2 || listeners[0].Addr().Network() != "tcp" || listeners[1].Addr().Network() != "unix" {
+		t.Errorf("listeners %v, want one tcp and one unix", listeners)
+	}
+}
+
+// TestOpenListenersCloses checks that the listeners opened before an
+// address that fails are closed again
+func TestOpenListenersCloses(t *testing.T) {
+	dir := t.TempDir()
+	sock := filepath.Join(dir, "uggdyn.sock")
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+	_, err = openListeners([]string{"unix:" + sock, "127.0.0.1:0", taken.Addr().String()})
+	if err == nil {
+		t.Fatalf("listening on a taken address succeeded")
+	}
+	// a closed unix listener removes its socket file
+	if _, err := os.Stat(sock); !os.IsNotExist(err) {
+		t.Errorf("socket %s left behind: %v", sock, err)
+	}
+	if lis, err := listenUnix(sock); err != nil {
+		t.Errorf("socket path still in use: %v", err)
+	} else {
+		lis.Close()
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	pb "github.com/rendicott/uggly"
+	"sort"
+	"strconv"
+)
+
+// menuPrevKey and menuNextKey move between the pages of a menu that has
+// more items than it can hand out keystrokes for. They are deliberately
+// not part of strokeMap so they can never collide with an item's key.
+const (
+	menuPrevKey = "<"
+	menuNextKey = ">"
+)
+
+// menuItem is one selectable line of a menu
+type menuItem struct {
+	label string
+	link  *pb.Link
+}
+
+// menu hands out keystrokes to a list of items. Items are sorted by label
+// so every render of the same items gives every item the same key. When
+// there are more items than keys, or than rows to show them in, the menu is
+// split into pages and menuPrevKey/menuNextKey link between them.
+type menu struct {
+	items    []menuItem
+	keys     []string
+	perPage  int
+	pageLink func(n int) (*pb.Link, error)
+}
+
+// menuKeys returns the keys of strokeMap that a page hasn't reserved for
+// something else, like the scroll keys of a detail page.
+func menuKeys(reserved ...string) []string {
+	var keys []string
+	for _, key := range strokeMap {
+		taken := false
+		for _, r := range reserved {
+			if key == r {
+				taken = true
+				break
+			}
+		}
+		if !taken {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// newMenu builds a menu that shows at most rows items per page. pageLink
+// builds the link to page n of the menu, pages are numbered from 1. It is
+// only called when the menu needs more than one page.
+func newMenu(items []menuItem, keys []string, rows int, pageLink func(n int) (*pb.Link, error)) *menu {
+	sorted := make([]menuItem, len(items))
+	copy(sorted, items)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].label < sorted[j].label
+	})
+	perPage := len(keys)
+	if rows < perPage {
+		perPage = rows
+	}
+	if perPage < 1 {
+		perPage = 1
+	}
+	return &menu{
+		items:    sorted,
+		keys:     keys,
+		perPage:  perPage,
+		pageLink: pageLink,
+	}
+}
+
+// pageCount is how many pages the menu is split into, always at least one
+func (m *menu) pageCount() int {
+	if len(m.items) == 0 {
+		return 1
+	}
+	return (len(m.items) + m.perPage - 1) / m.perPage
+}
+
+// parseMenuPage turns the page number captured by a route into a menu page.
+// An empty value is the first page.
+func parseMenuPage(s string) (int, error) {
+	if s == "" {
+		return 1, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return 0, errNotFound("'%s' isn't a page number of this menu.", s)
+	}
+	return n, nil
+}
+
+// routePageLink returns the pageLink of a menu whose pages are served by
+// the route registered under pattern with the page number as parameter "n"
+// next to any other parameters the route needs.
+func routePageLink(pattern string, params map[string]string) func(n int) (*pb.Link, error) {
+	return func(n int) (*pb.Link, error) {
+		withPage := map[string]string{"n": strconv.Itoa(n)}
+		for k, v := range params {
+			withPage[k] = v
+		}
+		return pages.link(pattern, withPage)
+	}
+}
+
+// render adds the keystrokes of page n of the menu to inPage and returns
+// the text listing the items of that page along with their keys. How many
+// pages there are depends on the client's height so a page number past the
+// end, which a client asks for again after its terminal grew, shows
+// the last page.
+func (m *menu) render(inPage *pb.PageResponse, n int) (string, error) {
+	if n > m.pageCount() {
+		n = m.pageCount()
+	}
+	if n < 1 {
+		n = 1
+	}
+	start := (n - 1) * m.perPage
+	end := start + m.perPage
+	if end > len(m.items) {
+		end = len(m.items)
+	}
+	content := ""
+	for i, item := range m.items[start:end] {
+		key := m.keys[i]
+		inPage.KeyStrokes = append(inPage.KeyStrokes, &pb.KeyStroke{
+			KeyStroke: key,
+			Action: &pb.KeyStroke_Link{
+				Link: item.link,
+			}})
+		content += fmt.Sprintf("(%s) %s\n", key, item.label)
+	}
+	if m.pageCount() == 1 {
+		return content, nil
+	}
+	content += fmt.Sprintf("\npage %d of %d", n, m.pageCount())
+	if n > 1 {
+		link, err := m.pageLink(n - 1)
+		if err != nil {
+			return "", err
+		}
+		inPage.KeyStrokes = append(inPage.KeyStrokes, &pb.KeyStroke{
+			KeyStroke: menuPrevKey,
+			Action:    &pb.KeyStroke_Link{Link: link}})
+		content += fmt.Sprintf("   (%s) previous", menuPrevKey)
+	}
+	if n < m.pageCount() {
+		link, err := m.pageLink(n + 1)
+		if err != nil {
+			return "", err
+		}
+		inPage.KeyStrokes = append(inPage.KeyStrokes, &pb.KeyStroke{
+			KeyStroke: menuNextKey,
+			Action:    &pb.KeyStroke_Link{Link: link}})
+		content += fmt.Sprintf("   (%s) next", menuNextKey)
+	}
+	return content + "\n", nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	pb "github.com/rendicott/uggly"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// testMenu builds a menu of count items, at most rows to a page, whose page links
+// lead to "menu/<n>"
+func testMenu(count, rows int) *menu {
+	var items []menuItem
+	for i := 0; i < count; i++ {
+		items = append(items, menuItem{
+			label: fmt.Sprintf("item %03d", i),
+			link:  &pb.Link{PageName: fmt.Sprintf("item/%d", i)},
+		})
+	}
+	return newMenu(items, menuKeys(), rows, func(n int) (*pb.Link, error) {
+		return &pb.Link{PageName: "menu/" + strconv.Itoa(n)}, nil
+	})
+}
+
+// strokes returns the keys of page mapped to the page names they link to
+func strokes(page *pb.PageResponse) map[string]string {
+	links := make(map[string]string)
+	for _, stroke := range page.KeyStrokes {
+		if l, ok := stroke.Action.(*pb.KeyStroke_Link); ok {
+			links[stroke.KeyStroke] = l.Link.PageName
+		}
+	}
+	return links
+}
+
+func TestMenuPageCount(t *testing.T) {
+	tests := []struct {
+		items int
+		rows  int
+		pages int
+	}{
+		{0, 10, 1},
+		{1, 10, 1},
+		{10, 10, 1},
+		{11, 10, 2},
+		{20, 10, 2},
+		{21, 10, 3},
+		{5, 0, 5},
+		{100, 200, 3},
+	}
+	for _, tt := range tests {
+		if got := testMenu(tt.items, tt.rows).pageCount(); got != tt.pages {
+			t.Errorf("%d items in %d rows: %d pages, want %d", tt.items, tt.rows, got, tt.pages)
+		}
+	}
+}
+
+func TestMenuRender(t *testing.T) {
+	tests := []struct {
+		items int
+		rows  int
+		n     int
+		// first and last item shown, and which pager keys are there
+		first, last string
+		prev, next  string
+	}{
+		{25, 10, 1, "item 000", "item 009", "", "menu/2"},
+		{25, 10, 2, "item 010", "item 019", "menu/1", "menu/3"},
+		{25, 10, 3, "item 020", "item 024", "menu/2", ""},
+		// past the end, as after the terminal grew, is the last page
+		{25, 10, 4, "item 020", "item 024", "menu/2", ""},
+		{25, 200, 4, "item 000", "item 024", "", ""},
+		{100, 200, 9, "item 070", "item 099", "menu/2", ""},
+		{25, 10, 0, "item 000", "item 009", "", "menu/2"},
+		{3, 10, 1, "item 000", "item 002", "", ""},
+	}
+	for _, tt := range tests {
+		name := fmt.Sprintf("%d items in %d rows page %d", tt.items, tt.rows, tt.n)
+		page := &pb.PageResponse{}
+		content, err := testMenu(tt.items, tt.rows).render(page, tt.n)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		lines := strings.Split(content, "\n")
+		if !strings.HasSuffix(lines[0], tt.first) {
+			t.Errorf("%s: first line '%s', want '%s'", name, lines[0], tt.first)
+		}
+		if !strings.Contains(content, tt.last) {
+			t.Errorf("%s: '%s' missing from\n%s", name, tt.last, content)
+		}
+		links := strokes(page)
+		if links[menuPrevKey] != tt.prev || links[menuNextKey] != tt.next {
+			t.Errorf("%s: prev '%s' next '%s', want '%s' and '%s'",
+				name, links[menuPrevKey], links[menuNextKey], tt.prev, tt.next)
+		}
+	}
+}
+
+func TestParseMenuPage(t *testing.T) {
+	tests := []struct {
+		s       string
+		n       int
+		wantErr bool
+	}{
+		{"", 1, false},
+		{"1", 1, false},
+		{"42", 42, false},
+		{"0", 0, true},
+		{"-3", 0, true},
+		{"two", 0, true},
+		{"2x", 0, true},
+	}
+	for _, tt := range tests {
+		n, err := parseMenuPage(tt.s)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseMenuPage('%s') error = %v, want error %v", tt.s, err, tt.wantErr)
+			continue
+		}
+		if n != tt.n {
+			t.Errorf("parseMenuPage('%s') = %d, want %d", tt.s, n, tt.n)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	pb "github.com/rendicott/uggly"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"log"
+	"net"
+	"strings"
+	"time"
+)
+
+// mountFlag collects every -mount flag given on the command line
+type mountFlag []string
+
+func (m *mountFlag) String() string {
+	return strings.Join(*m, ",")
+}
+
+func (m *mountFlag) Set(spec string) error {
+	*m = append(*m, spec)
+	return nil
+}
+
+var mountSpecs mountFlag
+
+func init() {
+	flag.Var(&mountSpecs, "mount", "Serve the pages of another uggly server under a prefix, repeatable. Written as "+
+		"'prefix=host:port' or 'prefix=tls://host:port', e.g. 'docs=docs-host:10000' serves its page 'one' as 'docs/one'")
+}
+
+// mount serves the pages of an upstream uggly server under prefix. The
+// page "prefix" is the upstream's default page and "prefix/name" is its page
+// "name". Links in upstream pages that lead back to the upstream are
+// rewritten to go through the mount so clients only ever talk to us.
+type mount struct {
+	prefix   string
+	upstream serverAddress
+	timeout  time.Duration
+	pages    pb.PageClient
+	feed     pb.FeedClient
+}
+
+// parseMountSpec splits a -mount value into its prefix and upstream address
+func parseMountSpec(spec string) (string, serverAddress, error) {
+	prefix, addr := "", spec
+	if i := strings.Index(spec, "="); i >= 0 {
+		prefix, addr = spec[:i], spec[i+1:]
+	}
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return "", serverAddress{}, fmt.Errorf("mount '%s' needs a prefix, as in 'prefix=host:port'", spec)
+	}
+	if strings.ContainsAny(prefix, "*?[\\{}") {
+		return "", serverAddress{}, fmt.Errorf("mount '%s': the prefix has to be a plain page name", spec)
+	}
+	upstream := serverAddress{}
+	if strings.HasPrefix(addr, "tls://") {
+		addr = strings.TrimPrefix(addr, "tls://")
+		upstream.secure = true
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", serverAddress{}, fmt.Errorf("mount '%s': %v", spec, err)
+	}
+	upstream.host, upstream.port = host, port
+	return prefix, upstream, nil
+}
+
+// newMount connects to the upstream of a -mount value. Connecting is lazy
+// so an upstream that is down when the server starts is not fatal.
+func newMount(spec string, timeout time.Duration) (*mount, error) {
+	prefix, upstream, err := parseMountSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+	creds := insecure.NewCredentials()
+	if upstream.secure {
+		creds = credentials.NewTLS(&tls.Config{ServerName: upstream.host})
+	}
+	conn, err := grpc.Dial(net.JoinHostPort(upstream.host, upstream.port), grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, fmt.Errorf("mount '%s': %v", spec, err)
+	}
+	return &mount{
+		prefix:   prefix,
+		upstream: upstream,
+		timeout:  timeout,
+		pages:    pb.NewPageClient(conn),
+		feed:     pb.NewFeedClient(conn),
+	}, nil
+}
+
+// routes returns the routes the mount serves. The upstream's feed is merged
+// into ours through the catch-all route, under the prefix as category.
+func (m *mount) routes() []*pageRoute {
+	return []*pageRoute{
+		{
+			pattern:  m.prefix,
+			handler:  m.serve,
+			category: m.prefix,
+		},
+		{
+			pattern:  m.prefix + "/{rest...}",
+			handler:  m.serve,
+			category: m.prefix,
+			feed:     m.listings,
+		},
+	}
+}
+
+// addMounts connects every -mount value and adds its routes to registry
+func addMounts(registry *pageRegistry, specs []string, timeout time.Duration) error {
+	for _, spec := range specs {
+		m, err := newMount(spec, timeout)
+		if err != nil {
+			return err
+		}
+		for _, route := range m.routes() {
+			if err := registry.add(route); err != nil {
+				return fmt.Errorf("mount '%s': %v", spec, err)
+			}
+		}
+		log.Printf("mounted %s under '%s'", net.JoinHostPort(m.upstream.host, m.upstream.port), m.prefix)
+	}
+	return nil
+}
+
+// outgoing returns the context calls to the upstream are made with, which
+// carries our request ID so a request can be traced across both servers.
+func (m *mount) outgoing(ctx context.Context) (context.Context, context.CancelFunc) {
+	if id := requestID(ctx); id != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, requestIDKey, id)
+	}
+	return context.WithTimeout(ctx, m.timeout)
+}
+
+// serve forwards preq to the upstream with its cookies, form data and
+// dimensions and returns the upstream's page with its links rewritten.
+// An upstream that can't be reached is reported as an upstream error, any
+// other status the upstream answers with is passed on to the client.
+func (m *mount) serve(ctx context.Context, preq *pb.PageRequest) (*pb.PageResponse, error) {
+	forward := proto.Clone(preq).(*pb.PageRequest)
+	forward.Name = routeParam(ctx, "rest")
+	forward.Server = m.upstream.host
+	forward.Port = m.upstream.port
+	forward.Secure = m.upstream.secure
+	callCtx, cancel := m.outgoing(ctx)
+	defer cancel()
+	presp, err := m.pages.GetPage(callCtx, forward)
+	if err != nil {
+		return nil, m.upstreamError(err)
+	}
+	m.rewrite(presp)
+	presp.Name = preq.Name
+	return presp, nil
+}
+
+// upstreamError turns an error of a call to the upstream into ours. The
+// page attached to an upstream status gets its links rewritten too so the
+// way back home leads to the upstream's home under the prefix.
+func (m *mount) upstreamError(err error) error {
+	st := status.Convert(err)
+	switch st.Code() {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return errUpstream(err, "The server mounted at '%s' can't be reached right now, try again in a bit.", m.prefix)
+	}
+	var page *pb.PageResponse
+	for _, detail := range st.Details() {
+		if p, ok := detail.(*pb.PageResponse); ok {
+			page = p
+			m.rewrite(page)
+		}
+	}
+	return pageStatus(st.Code(), page, "%s", st.Message())
+}
+
+// defaultUgglyPort is the port uggly clients connect to when a link names
+// a server without one
+const defaultUgglyPort = "10000"
+
+// leadsUpstream reports whether link points at the upstream, either
+// relative to the current server or with the upstream's address spelt out.
+func (m *mount) leadsUpstream(link *pb.Link) bool {
+	if link.Server == "" {
+		return true
+	}
+	port := link.Port
+	if port == "" {
+		port = defaultUgglyPort
+	}
+	return strings.EqualFold(link.Server, m.upstream.host) && port == m.upstream.port
+}
+
+// link returns the link through the mount to the upstream page pageName
+func (m *mount) link(pageName string) *pb.Link {
+	if pageName == "" {
+		return localLink(m.prefix)
+	}
+	return localLink(m.prefix + "/" + pageName)
+}
+
+// rewrite points the keystroke links and form submit links of an upstream
+// page that lead back to the upstream at the mount instead. Links to any
+// other server are left alone.
+func (m *mount) rewrite(page *pb.PageResponse) {
+	for _, stroke := range page.KeyStrokes {
+		if l, ok := stroke.Action.(*pb.KeyStroke_Link); ok && l.Link != nil && m.leadsUpstream(l.Link) {
+			link := m.link(l.Link.PageName)
+			link.KeyStroke = l.Link.KeyStroke
+			l.Link = link
+		}
+	}
+	if page.Elements == nil {
+		return
+	}
+	for _, form := range page.Elements.Forms {
+		if form.SubmitLink != nil && m.leadsUpstream(form.SubmitLink) {
+			link := m.link(form.SubmitLink.PageName)
+			link.KeyStroke = form.SubmitLink.KeyStroke
+			form.SubmitLink = link
+		}
+	}
+}
+
+// listings fetches the upstream's feed and returns it under the prefix. An
+// upstream that doesn't answer is logged and left out of our feed rather
+// than failing it.
+func (m *mount) listings(ctx context.Context) []*pb.PageListing {
+	callCtx, cancel := m.outgoing(ctx)
+	defer cancel()
+	fresp, err := m.feed.GetFeed(callCtx, &pb.FeedRequest{})
+	if err != nil {
+		log.Printf("mount '%s': leaving the upstream feed out: %v", m.prefix, err)
+		return nil
+	}
+	var listings []*pb.PageListing
+	for _, listing := range fresp.Pages {
+		listings = append(listings, &pb.PageListing{
+			Name:        m.prefix + "/" + listing.Name,
+			Description: fmt.Sprintf("[%s] %s", m.prefix, listing.Description),
+		})
+	}
+	return listings
+}
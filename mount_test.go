@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"errors"
+	pb "github.com/rendicott/uggly"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"testing"
+	"time"
+)
+
+// fakeUpstream is an uggly server that records the last page request and
+// answers with page or err
+type fakeUpstream struct {
+	pb.UnimplementedPageServer
+	pb.UnimplementedFeedServer
+	got  *pb.PageRequest
+	page *pb.PageResponse
+	err  error
+	feed []*pb.PageListing
+}
+
+func (u *fakeUpstream) GetPage(ctx context.Context, preq *pb.PageRequest) (*pb.PageResponse, error) {
+	u.got = preq
+	return u.page, u.err
+}
+
+func (u *fakeUpstream) GetFeed(ctx context.Context, freq *pb.FeedRequest) (*pb.FeedResponse, error) {
+	return &pb.FeedResponse{Pages: u.feed}, nil
+}
+
+// testMount serves upstream in process and returns a mount of it under
+// "docs" as if it were the server up.example:10000
+func testMount(t *testing.T, upstream *fakeUpstream) *mount {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	pb.RegisterPageServer(srv, upstream)
+	pb.RegisterFeedServer(srv, upstream)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &mount{
+		prefix:   "docs",
+		upstream: serverAddress{host: "up.example", port: "10000"},
+		timeout:  time.Second,
+		pages:    pb.NewPageClient(conn),
+		feed:     pb.NewFeedClient(conn),
+	}
+}
+
+// serveMounted looks name up in a registry holding only m and serves it
+func serveMounted(t *testing.T, m *mount, preq *pb.PageRequest) (*pb.PageResponse, error) {
+	t.Helper()
+	r := newPageRegistry()
+	for _, route := range m.routes() {
+		r.register(route)
+	}
+	route, params, ok := r.lookup(preq.Name)
+	if !ok {
+		t.Fatalf("no route for '%s'", preq.Name)
+	}
+	return route.handler(withRouteParams(context.Background(), params), preq)
+}
+
+func TestMountForwards(t *testing.T) {
+	upstream := &fakeUpstream{page: &pb.PageResponse{Name: "guide/intro"}}
+	m := testMount(t, upstream)
+	preq := &pb.PageRequest{
+		Name:         "docs/guide/intro",
+		ClientWidth:  80,
+		ClientHeight: 24,
+		SendCookies:  []*pb.Cookie{{Key: "name", Value: "Ada"}},
+		FormData:     []*pb.FormData{{Name: "f", TextBoxData: []*pb.TextBoxData{{Name: "age", Contents: "36"}}}},
+	}
+	presp, err := serveMounted(t, m, preq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := upstream.got
+	if got.Name != "guide/intro" || got.Server != "up.example" || got.Port != "10000" {
+		t.Errorf("upstream got page '%s' on %s:%s, want 'guide/intro' on up.example:10000", got.Name, got.Server, got.Port)
+	}
+	if got.ClientWidth != 80 || got.ClientHeight != 24 {
+		t.Errorf("upstream got %dx%d, want 80x24", got.ClientWidth, got.ClientHeight)
+	}
+	if len(got.SendCookies) != 1 || got.SendCookies[0].Value != "Ada" {
+		t.Errorf("upstream got cookies %v", got.SendCookies)
+	}
+	if len(got.FormData) != 1 || got.FormData[0].TextBoxData[0].Contents != "36" {
+		t.Errorf("upstream got form data %v", got.FormData)
+	}
+	if presp.Name != "docs/guide/intro" {
+		t.Errorf("page name '%s', want 'docs/guide/intro'", presp.Name)
+	}
+	// the prefix on its own is the upstream's default page
+	if _, err := serveMounted(t, m, &pb.PageRequest{Name: "docs"}); err != nil || upstream.got.Name != "" {
+		t.Errorf("'docs' asked the upstream for '%s', %v, want its default page", upstream.got.Name, err)
+	}
+}
+
+func TestMountRewritesLinks(t *testing.T) {
+	stroke := func(link *pb.Link) *pb.KeyStroke {
+		return &pb.KeyStroke{KeyStroke: "k", Action: &pb.KeyStroke_Link{Link: link}}
+	}
+	upstream := &fakeUpstream{page: &pb.PageResponse{
+		KeyStrokes: []*pb.KeyStroke{
+			stroke(&pb.Link{PageName: "two"}),
+			stroke(&pb.Link{PageName: "three", Server: "up.example", Port: "10000"}),
+			stroke(&pb.Link{PageName: "", Server: "up.example", Port: "10000"}),
+			stroke(&pb.Link{PageName: "elsewhere", Server: "other.example", Port: "10000"}),
+			stroke(&pb.Link{PageName: "same host", Server: "up.example", Port: "9999"}),
+		},
+		Elements: &pb.Elements{Forms: []*pb.Form{
+			{Name: "f", SubmitLink: &pb.Link{PageName: "submit"}},
+			{Name: "g", SubmitLink: &pb.Link{PageName: "away", Server: "other.example", Port: "10000"}},
+		}},
+	}}
+	m := testMount(t, upstream)
+	presp, err := serveMounted(t, m, &pb.PageRequest{Name: "docs/one"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct{ page, server string }{
+		{"docs/two", ""},
+		{"docs/three", ""},
+		{"docs", ""},
+		{"elsewhere", "other.example"},
+		{"same host", "up.example"},
+	}
+	for i, w := range want {
+		link := presp.KeyStrokes[i].Action.(*pb.KeyStroke_Link).Link
+		if link.PageName != w.page || link.Server != w.server {
+			t.Errorf("link %d leads to '%s' on '%s', want '%s' on '%s'", i, link.PageName, link.Server, w.page, w.server)
+		}
+	}
+	forms := presp.Elements.Forms
+	if forms[0].SubmitLink.PageName != "docs/submit" || forms[0].SubmitLink.Server != "" {
+		t.Errorf("submit link %v, want docs/submit here", forms[0].SubmitLink)
+	}
+	if forms[1].SubmitLink.PageName != "away" || forms[1].SubmitLink.Server != "other.example" {
+		t.Errorf("submit link %v to another server was rewritten", forms[1].SubmitLink)
+	}
+}
+
+func TestMountUpstreamErrors(t *testing.T) {
+	home := &pb.PageResponse{KeyStrokes: []*pb.KeyStroke{
+		{KeyStroke: "h", Action: &pb.KeyStroke_Link{Link: &pb.Link{PageName: "home"}}},
+	}}
+	m := testMount(t, &fakeUpstream{err: status.Error(codes.Unavailable, "down")})
+	_, err := serveMounted(t, m, &pb.PageRequest{Name: "docs/one"})
+	var perr *pageError
+	if !errors.As(err, &perr) || perr.kind != errKindUpstream {
+		t.Errorf("unavailable upstream gave %v, want an upstream error", err)
+	}
+
+	m = testMount(t, &fakeUpstream{err: pageStatus(codes.NotFound, home, "no such page")})
+	_, err = serveMounted(t, m, &pb.PageRequest{Name: "docs/one"})
+	st := status.Convert(err)
+	if st.Code() != codes.NotFound {
+		t.Fatalf("upstream NotFound gave %v", err)
+	}
+	var page *pb.PageResponse
+	for _, detail := range st.Details() {
+		page, _ = detail.(*pb.PageResponse)
+	}
+	if page == nil || page.KeyStrokes[0].Action.(*pb.KeyStroke_Link).Link.PageName != "docs/home" {
+		t.Errorf("upstream error page %v, want its link rewritten to docs/home", page)
+	}
+}
+
+func TestMountFeed(t *testing.T) {
+	m := testMount(t, &fakeUpstream{feed: []*pb.PageListing{
+		{Name: "one", Description: "the first"},
+		{Name: "two/deep", Description: "the second"},
+	}})
+	r := newPageRegistry()
+	r.register(&pageRoute{pattern: "about", handler: nopHandler, listed: true, category: "about"})
+	for _, route := range m.routes() {
+		r.register(route)
+	}
+	listings := r.listings(context.Background(), feedFilter{})
+	want := []struct{ name, description string }{
+		{"about", ""},
+		{"docs/one", "[docs] the first"},
+		{"docs/two/deep", "[docs] the second"},
+	}
+	if len(listings) != len(want) {
+		t.Fatalf("feed %v, want %d listings", listings, len(want))
+	}
+	for i, w := range want {
+		if listings[i].Name != w.name || (w.description != "" && listings[i].Description != w.description) {
+			t.Errorf("listing %d = '%s' '%s', want '%s' '%s'", i, listings[i].Name, listings[i].Description, w.name, w.description)
+		}
+	}
+	if got := r.listings(context.Background(), feedFilter{category: "about"}); len(got) != 1 {
+		t.Errorf("feed of category 'about' has %d listings, want 1", len(got))
+	}
+}
+
+func TestMountLeadsUpstream(t *testing.T) {
+	tests := []struct {
+		upstreamPort string
+		link         *pb.Link
+		want         bool
+	}{
+		{"10000", &pb.Link{PageName: "one"}, true},
+		{"10000", &pb.Link{Server: "up.example", Port: "10000"}, true},
+		// no port is the port clients use by default
+		{"10000", &pb.Link{Server: "up.example"}, true},
+		{"9999", &pb.Link{Server: "up.example"}, false},
+		{"9999", &pb.Link{Server: "up.example", Port: "9999"}, true},
+		{"10000", &pb.Link{Server: "UP.example", Port: "10000"}, true},
+		{"10000", &pb.Link{Server: "up.example", Port: "10001"}, false},
+		{"10000", &pb.Link{Server: "other.example"}, false},
+	}
+	for _, tt := range tests {
+		m := &mount{prefix: "docs", upstream: serverAddress{host: "up.example", port: tt.upstreamPort}}
+		if got := m.leadsUpstream(tt.link); got != tt.want {
+			t.Errorf("upstream on port %s: leadsUpstream(%s:%s) = %v, want %v",
+				tt.upstreamPort, tt.link.Server, tt.link.Port, got, tt.want)
+		}
+	}
+}
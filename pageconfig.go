@@ -0,0 +1,420 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	pb "github.com/rendicott/uggly"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// pageConfig is the layout of a page config file. Files are YAML and since
+// JSON is valid YAML they can be written as JSON too. Styles are named so
+// pages can share them and every page becomes a route of its own.
+type pageConfig struct {
+	Styles map[string]styleDef `yaml:"styles"`
+	Pages  []pageDef           `yaml:"pages"`
+}
+
+// pageDef describes a page the way pageRoute and pb.PageResponse do. Every
+// position and size is a sizeExpr over the client's width and height and
+// text, styles and link targets are textTemplates over the request. A page
+// with exec or script has no layout of its own, a program or a script
+// builds it instead.
+type pageDef struct {
+	Name        string         `yaml:"name"`
+	Description string         `yaml:"description"`
+	Category    string         `yaml:"category"`
+	Listed      bool           `yaml:"listed"`
+	Order       int            `yaml:"order"`
+	MinWidth    int            `yaml:"minWidth"`
+	MinHeight   int            `yaml:"minHeight"`
+	DivBoxes    []divBoxDef    `yaml:"divBoxes"`
+	TextBlobs   []textBlobDef  `yaml:"textBlobs"`
+	Forms       []formDef      `yaml:"forms"`
+	KeyStrokes  []keyStrokeDef `yaml:"keyStrokes"`
+	Exec        *execDef       `yaml:"exec"`
+	Script      *scriptDef     `yaml:"script"`
+}
+
+type divBoxDef struct {
+	Name        string   `yaml:"name"`
+	Border      bool     `yaml:"border"`
+	BorderW     int      `yaml:"borderW"`
+	BorderChar  string   `yaml:"borderChar"`
+	FillChar    string   `yaml:"fillChar"`
+	StartX      sizeExpr `yaml:"startX"`
+	StartY      sizeExpr `yaml:"startY"`
+	Width       sizeExpr `yaml:"width"`
+	Height      sizeExpr `yaml:"height"`
+	BorderStyle styleRef `yaml:"borderStyle"`
+	FillStyle   styleRef `yaml:"fillStyle"`
+}
+
+type textBlobDef struct {
+	Content  textTemplate `yaml:"content"`
+	Wrap     bool         `yaml:"wrap"`
+	Style    styleRef     `yaml:"style"`
+	DivNames []string     `yaml:"divNames"`
+}
+
+// formDef is a form whose data is sent to the page named by submit
+type formDef struct {
+	Name      string       `yaml:"name"`
+	DivName   string       `yaml:"divName"`
+	Submit    string       `yaml:"submit"`
+	TextBoxes []textBoxDef `yaml:"textBoxes"`
+}
+
+type textBoxDef struct {
+	Name             string       `yaml:"name"`
+	TabOrder         int          `yaml:"tabOrder"`
+	DefaultValue     textTemplate `yaml:"defaultValue"`
+	Description      textTemplate `yaml:"description"`
+	ShowDescription  bool         `yaml:"showDescription"`
+	Password         bool         `yaml:"password"`
+	PositionX        sizeExpr     `yaml:"positionX"`
+	PositionY        sizeExpr     `yaml:"positionY"`
+	Width            sizeExpr     `yaml:"width"`
+	Height           sizeExpr     `yaml:"height"`
+	CursorStyle      styleRef     `yaml:"cursorStyle"`
+	FillStyle        styleRef     `yaml:"fillStyle"`
+	TextStyle        styleRef     `yaml:"textStyle"`
+	DescriptionStyle styleRef     `yaml:"descriptionStyle"`
+}
+
+// keyStrokeDef binds a key to exactly one of following a link to page,
+// scrolling the div named by scroll or activating form. A link without a
+// server stays on this server.
+type keyStrokeDef struct {
+	Key    string       `yaml:"key"`
+	Page   textTemplate `yaml:"page"`
+	Server string       `yaml:"server"`
+	Port   string       `yaml:"port"`
+	Secure bool         `yaml:"secure"`
+	Scroll string       `yaml:"scroll"`
+	Down   bool         `yaml:"down"`
+	Form   string       `yaml:"form"`
+}
+
+// styleDef is a pb.Style. Attr defaults to "4" like shelp.
+type styleDef struct {
+	Fg   textTemplate `yaml:"fg"`
+	Bg   textTemplate `yaml:"bg"`
+	Attr textTemplate `yaml:"attr"`
+}
+
+// defaultStyle is the style of an empty styleRef
+var defaultStyle = styleDef{
+	Fg: textTemplate{src: "white"},
+	Bg: textTemplate{src: "black"},
+}
+
+// styleRef is either the name of a style from the file's styles or a style
+// written out in place. compilePage resolves it into def.
+type styleRef struct {
+	name   string
+	inline *styleDef
+	def    *styleDef
+}
+
+// UnmarshalYAML accepts a style name or a style
+func (r *styleRef) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&r.name); err == nil {
+		return nil
+	}
+	r.inline = &styleDef{}
+	return unmarshal(r.inline)
+}
+
+// resolve looks up the style the reference stands for. An empty reference
+// is white on black.
+func (r *styleRef) resolve(styles map[string]styleDef) error {
+	switch {
+	case r.inline != nil:
+		r.def = r.inline
+	case r.name == "":
+		r.def = &defaultStyle
+	default:
+		def, ok := styles[r.name]
+		if !ok {
+			return fmt.Errorf("unknown style '%s'", r.name)
+		}
+		r.def = &def
+	}
+	return nil
+}
+
+// configPage is a pageDef checked and with its styles resolved, ready to be
+// served by handler for any client size.
+type configPage struct {
+	def     pageDef
+	handler pageHandler
+}
+
+// compilePage checks that everything a page refers to exists and resolves
+// its styles so rendering it can only fail in its templates. dir is the
+// directory of the config file the page came from.
+func compilePage(def pageDef, styles map[string]styleDef, dir string) (*configPage, error) {
+	if def.Name == "" {
+		return nil, fmt.Errorf("page without a name")
+	}
+	if def.Exec != nil || def.Script != nil {
+		if len(def.DivBoxes)+len(def.TextBlobs)+len(def.Forms)+len(def.KeyStrokes) > 0 {
+			return nil, fmt.Errorf("page '%s': exec and script pages can't have a layout too", def.Name)
+		}
+		if def.Exec != nil && def.Script != nil {
+			return nil, fmt.Errorf("page '%s': needs one of exec or script, not both", def.Name)
+		}
+	}
+	if def.Exec != nil {
+		program, err := newExecPage(def.Name, *def.Exec, dir)
+		if err != nil {
+			return nil, err
+		}
+		return &configPage{def: def, handler: program.serve}, nil
+	}
+	if def.Script != nil {
+		script, err := newScriptPage(def.Name, *def.Script, dir)
+		if err != nil {
+			return nil, err
+		}
+		return &configPage{def: def, handler: script.serve}, nil
+	}
+	resolve := func(refs ...*styleRef) error {
+		for _, ref := range refs {
+			if err := ref.resolve(styles); err != nil {
+				return fmt.Errorf("page '%s': %v", def.Name, err)
+			}
+		}
+		return nil
+	}
+	divs := make(map[string]bool)
+	for i := range def.DivBoxes {
+		box := &def.DivBoxes[i]
+		if box.Name == "" || divs[box.Name] {
+			return nil, fmt.Errorf("page '%s': div boxes need unique names, got '%s'", def.Name, box.Name)
+		}
+		divs[box.Name] = true
+		if err := resolve(&box.BorderStyle, &box.FillStyle); err != nil {
+			return nil, err
+		}
+	}
+	for i := range def.TextBlobs {
+		blob := &def.TextBlobs[i]
+		for _, div := range blob.DivNames {
+			if !divs[div] {
+				return nil, fmt.Errorf("page '%s': text blob in unknown div '%s'", def.Name, div)
+			}
+		}
+		if err := resolve(&blob.Style); err != nil {
+			return nil, err
+		}
+	}
+	forms := make(map[string]bool)
+	for _, form := range def.Forms {
+		if form.Name == "" || forms[form.Name] {
+			return nil, fmt.Errorf("page '%s': forms need unique names, got '%s'", def.Name, form.Name)
+		}
+		forms[form.Name] = true
+		if !divs[form.DivName] {
+			return nil, fmt.Errorf("page '%s': form '%s' in unknown div '%s'", def.Name, form.Name, form.DivName)
+		}
+		if form.Submit == "" {
+			return nil, fmt.Errorf("page '%s': form '%s' needs a submit page", def.Name, form.Name)
+		}
+		for i := range form.TextBoxes {
+			box := &form.TextBoxes[i]
+			if err := resolve(&box.CursorStyle, &box.FillStyle, &box.TextStyle, &box.DescriptionStyle); err != nil {
+				return nil, err
+			}
+		}
+	}
+	keys := make(map[string]bool)
+	for _, stroke := range def.KeyStrokes {
+		if stroke.Key == "" || keys[stroke.Key] {
+			return nil, fmt.Errorf("page '%s': keystrokes need unique keys, got '%s'", def.Name, stroke.Key)
+		}
+		keys[stroke.Key] = true
+		actions := 0
+		for _, set := range []bool{stroke.Page.src != "", stroke.Scroll != "", stroke.Form != ""} {
+			if set {
+				actions++
+			}
+		}
+		if actions != 1 {
+			return nil, fmt.Errorf("page '%s': keystroke '%s' needs exactly one of page, scroll or form",
+				def.Name, stroke.Key)
+		}
+		if stroke.Scroll != "" && !divs[stroke.Scroll] {
+			return nil, fmt.Errorf("page '%s': keystroke '%s' scrolls unknown div '%s'", def.Name, stroke.Key, stroke.Scroll)
+		}
+		if stroke.Form != "" && !forms[stroke.Form] {
+			return nil, fmt.Errorf("page '%s': keystroke '%s' activates unknown form '%s'", def.Name, stroke.Key, stroke.Form)
+		}
+	}
+	page := &configPage{def: def}
+	page.handler = page.render
+	return page, nil
+}
+
+// render builds the page for the request. Template errors fail the whole
+// page, errors from the data a template asked for keep their kind.
+func (p *configPage) render(ctx context.Context, preq *pb.PageRequest) (*pb.PageResponse, error) {
+	r := &pageRenderer{data: newTemplateData(ctx, preq)}
+	localPage := pb.PageResponse{
+		Name:     preq.Name,
+		DivBoxes: &pb.DivBoxes{},
+		Elements: &pb.Elements{},
+	}
+	for _, box := range p.def.DivBoxes {
+		localPage.DivBoxes.Boxes = append(localPage.DivBoxes.Boxes, &pb.DivBox{
+			Name:       box.Name,
+			Border:     box.Border,
+			BorderW:    int32(box.BorderW),
+			BorderChar: convertStringCharRune(box.BorderChar),
+			FillChar:   convertStringCharRune(box.FillChar),
+			StartX:     r.size(box.StartX),
+			StartY:     r.size(box.StartY),
+			Width:      r.size(box.Width),
+			Height:     r.size(box.Height),
+			BorderSt:   r.style(box.BorderStyle),
+			FillSt:     r.style(box.FillStyle),
+		})
+	}
+	for _, blob := range p.def.TextBlobs {
+		localPage.Elements.TextBlobs = append(localPage.Elements.TextBlobs, &pb.TextBlob{
+			Content:  r.text(blob.Content),
+			Wrap:     blob.Wrap,
+			Style:    r.style(blob.Style),
+			DivNames: blob.DivNames,
+		})
+	}
+	for _, form := range p.def.Forms {
+		pbForm := &pb.Form{
+			Name:       form.Name,
+			DivName:    form.DivName,
+			SubmitLink: localLink(form.Submit),
+		}
+		for _, box := range form.TextBoxes {
+			pbForm.TextBoxes = append(pbForm.TextBoxes, &pb.TextBox{
+				Name:             box.Name,
+				TabOrder:         int32(box.TabOrder),
+				DefaultValue:     r.text(box.DefaultValue),
+				Description:      r.text(box.Description),
+				ShowDescription:  box.ShowDescription,
+				Password:         box.Password,
+				PositionX:        r.size(box.PositionX),
+				PositionY:        r.size(box.PositionY),
+				Width:            r.size(box.Width),
+				Height:           r.size(box.Height),
+				StyleCursor:      r.style(box.CursorStyle),
+				StyleFill:        r.style(box.FillStyle),
+				StyleText:        r.style(box.TextStyle),
+				StyleDescription: r.style(box.DescriptionStyle),
+			})
+		}
+		localPage.Elements.Forms = append(localPage.Elements.Forms, pbForm)
+	}
+	for _, stroke := range p.def.KeyStrokes {
+		keyStroke := &pb.KeyStroke{KeyStroke: stroke.Key}
+		switch {
+		case stroke.Page.src != "" && stroke.Server != "":
+			keyStroke.Action = &pb.KeyStroke_Link{Link: serverAddress{
+				host:   stroke.Server,
+				port:   stroke.Port,
+				secure: stroke.Secure,
+			}.link(r.text(stroke.Page))}
+		case stroke.Page.src != "":
+			keyStroke.Action = &pb.KeyStroke_Link{Link: localLink(r.text(stroke.Page))}
+		case stroke.Scroll != "":
+			keyStroke.Action = &pb.KeyStroke_DivScroll{DivScroll: &pb.DivScroll{
+				DivName: stroke.Scroll,
+				Down:    stroke.Down,
+			}}
+		case stroke.Form != "":
+			keyStroke.Action = &pb.KeyStroke_FormActivation{FormActivation: &pb.FormActivation{
+				FormName: stroke.Form,
+			}}
+		}
+		localPage.KeyStrokes = append(localPage.KeyStrokes, keyStroke)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return &localPage, nil
+}
+
+// route returns the pageRoute that serves the page
+func (p *configPage) route() *pageRoute {
+	return &pageRoute{
+		pattern:     p.def.Name,
+		handler:     p.handler,
+		listed:      p.def.Listed,
+		description: p.def.Description,
+		category:    p.def.Category,
+		order:       p.def.Order,
+		minWidth:    p.def.MinWidth,
+		minHeight:   p.def.MinHeight,
+	}
+}
+
+// pageConfigExts are the extensions of the files loaded from a config directory
+var pageConfigExts = map[string]bool{".yaml": true, ".yml": true, ".json": true}
+
+// pageConfigFiles returns the config files at path. A directory means every
+// file in it with one of pageConfigExts, sorted by name.
+func pageConfigFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	entries, err := ioutil.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		if !entry.IsDir() && pageConfigExts[strings.ToLower(filepath.Ext(entry.Name()))] {
+			files = append(files, filepath.Join(path, entry.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// loadPageConfig reads the page config file or directory at path and
+// returns the routes of every page in it. Nothing is returned unless every
+// file parses and every page compiles.
+func loadPageConfig(path string) ([]*pageRoute, error) {
+	files, err := pageConfigFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	var routes []*pageRoute
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var config pageConfig
+		if err := yaml.UnmarshalStrict(data, &config); err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		for _, def := range config.Pages {
+			page, err := compilePage(def, config.Styles, filepath.Dir(file))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", file, err)
+			}
+			routes = append(routes, page.route())
+		}
+	}
+	return routes, nil
+}
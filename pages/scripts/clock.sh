@@ -0,0 +1,26 @@
+#!/bin/sh
+# clock serves the "clock" page from pages/clock.yaml. The PageRequest
+# arrives as JSON on stdin, this script only needs the UGGLY_* variables.
+cat >/dev/null
+width=$((UGGLY_WIDTH - 4))
+now=$(date '+%H:%M:%S')
+cat <<JSON
+{
+  "divBoxes": {"boxes": [{
+    "name": "clock", "border": true, "borderW": 1, "borderChar": 42,
+    "startX": 2, "startY": 1, "width": $width, "Height": 5,
+    "borderSt": {"fg": "springgreen", "bg": "black", "attr": "4"},
+    "fillSt": {"fg": "white", "bg": "black", "attr": "4"}
+  }]},
+  "elements": {"textBlobs": [{
+    "content": "It is $now on the server.\n(r) refresh   (h) home",
+    "wrap": true,
+    "style": {"fg": "white", "bg": "black", "attr": "4"},
+    "divNames": ["clock"]
+  }]},
+  "keyStrokes": [
+    {"keyStroke": "r", "link": {"pageName": "clock"}},
+    {"keyStroke": "h", "link": {"pageName": "home"}}
+  ]
+}
+JSON
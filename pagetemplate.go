@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	pb "github.com/rendicott/uggly"
+	"strings"
+	"text/template"
+)
+
+// textTemplate is a string in a page config that may use Go text/template
+// actions to refer to the request, see templateData. It is parsed once when
+// the config is loaded and strings without actions skip templating entirely.
+type textTemplate struct {
+	src  string
+	tmpl *template.Template
+}
+
+// parseTextTemplate parses src. Missing cookies, form fields and route
+// parameters render as empty strings rather than "<no value>".
+func parseTextTemplate(src string) (textTemplate, error) {
+	if !strings.Contains(src, "{{") {
+		return textTemplate{src: src}, nil
+	}
+	tmpl, err := template.New("page").Option("missingkey=zero").Parse(src)
+	if err != nil {
+		return textTemplate{}, err
+	}
+	return textTemplate{src: src, tmpl: tmpl}, nil
+}
+
+// UnmarshalYAML parses the template as the config is read
+func (t *textTemplate) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var src string
+	if err := unmarshal(&src); err != nil {
+		return err
+	}
+	parsed, err := parseTextTemplate(src)
+	if err != nil {
+		return err
+	}
+	*t = parsed
+	return nil
+}
+
+// String returns the start of the template as it was written, short
+// enough to point out the template in an error message.
+func (t textTemplate) String() string {
+	excerpt := strings.SplitN(t.src, "\n", 2)[0]
+	if len(excerpt) > 40 || excerpt != t.src {
+		if len(excerpt) > 40 {
+			excerpt = excerpt[:40]
+		}
+		excerpt += "..."
+	}
+	return excerpt
+}
+
+// render executes the template for data
+func (t textTemplate) render(data *templateData) (string, error) {
+	if t.tmpl == nil {
+		return t.src, nil
+	}
+	var b strings.Builder
+	if err := t.tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// templateData is what page config templates can refer to: {{.Width}} and
+// {{.Height}} of the client, {{.Cookies.name}}, {{.Form.age}} from a
+// submitted form, {{.Params.id}} captured by the page's route and
+// {{.Wizards}} from the wizard source, which is only fetched when a template
+// uses it.
+type templateData struct {
+	ctx     context.Context
+	Page    string
+	Width   int
+	Height  int
+	Cookies map[string]string
+	Form    map[string]string
+	Params  map[string]string
+}
+
+// newTemplateData collects the template data of a request
+func newTemplateData(ctx context.Context, preq *pb.PageRequest) *templateData {
+	data := &templateData{
+		ctx:     ctx,
+		Page:    preq.Name,
+		Width:   int(preq.ClientWidth),
+		Height:  int(preq.ClientHeight),
+		Cookies: make(map[string]string),
+		Form:    make(map[string]string),
+		Params:  routeParams(ctx),
+	}
+	for _, cookie := range preq.SendCookies {
+		data.Cookies[cookie.Key] = cookie.Value
+	}
+	for _, fd := range preq.FormData {
+		for _, td := range fd.TextBoxData {
+			data.Form[td.Name] = td.Contents
+		}
+	}
+	return data
+}
+
+// Wizards returns the wizards of the wizard source
+func (d *templateData) Wizards() ([]Wizard, error) {
+	index, err := loadWizardIndex(d.ctx)
+	if err != nil {
+		return nil, err
+	}
+	return index.wizards, nil
+}
+
+// pageRenderer renders the templates and sizes of a config page for one
+// request. The first error sticks and every later call is a no-op so
+// render can build the whole page and check err once at the end.
+type pageRenderer struct {
+	data *templateData
+	err  error
+}
+
+// text renders t
+func (r *pageRenderer) text(t textTemplate) string {
+	if r.err != nil {
+		return ""
+	}
+	s, err := t.render(r.data)
+	if err != nil {
+		r.err = fmt.Errorf("template '%s': %w", t, err)
+	}
+	return s
+}
+
+// size evaluates e, sizes can't go below zero however small the client is
+func (r *pageRenderer) size(e sizeExpr) int32 {
+	if r.err != nil {
+		return 0
+	}
+	n, err := e.eval(r.data)
+	if err != nil {
+		r.err = err
+	}
+	return int32(atLeast(n, 0))
+}
+
+// style renders the style ref was resolved to
+func (r *pageRenderer) style(ref styleRef) *pb.Style {
+	attr := r.text(ref.def.Attr)
+	if attr == "" {
+		attr = "4"
+	}
+	return &pb.Style{
+		Fg:   r.text(ref.def.Fg),
+		Bg:   r.text(ref.def.Bg),
+		Attr: attr,
+	}
+}
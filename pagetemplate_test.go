@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	pb "github.com/rendicott/uggly"
+	"gopkg.in/yaml.v2"
+	"strings"
+	"testing"
+)
+
+// testTemplateData is a 80x24 request with a cookie, a form field and a
+// route parameter
+func testTemplateData() *templateData {
+	return &templateData{
+		ctx:     context.Background(),
+		Page:    "hello/bob",
+		Width:   80,
+		Height:  24,
+		Cookies: map[string]string{"name": "Ada"},
+		Form:    map[string]string{"age": "36"},
+		Params:  map[string]string{"who": "bob"},
+	}
+}
+
+func TestTextTemplateRender(t *testing.T) {
+	tests := []struct {
+		src     string
+		want    string
+		wantErr bool
+	}{
+		{"plain text", "plain text", false},
+		{"{{.Width}}x{{.Height}}", "80x24", false},
+		{"hi {{.Cookies.name}}", "hi Ada", false},
+		{"age {{.Form.age}}", "age 36", false},
+		{"hello {{.Params.who}} on {{.Page}}", "hello bob on hello/bob", false},
+		// missing keys are empty rather than "<no value>"
+		{"[{{.Cookies.missing}}]", "[]", false},
+		{"{{if .Cookies.name}}back{{else}}new{{end}}", "back", false},
+		{"{{if gt .Width 100}}wide{{else}}narrow{{end}}", "narrow", false},
+		{"{{.Nope}}", "", true},
+	}
+	for _, tt := range tests {
+		tmpl, err := parseTextTemplate(tt.src)
+		if err != nil {
+			t.Errorf("parseTextTemplate('%s'): %v", tt.src, err)
+			continue
+		}
+		got, err := tmpl.render(testTemplateData())
+		if (err != nil) != tt.wantErr {
+			t.Errorf("'%s' error = %v, want error %v", tt.src, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("'%s' = '%s', want '%s'", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestTextTemplateParseError(t *testing.T) {
+	for _, src := range []string{"{{.Width", "{{if .Width}}", "{{end}}"} {
+		if _, err := parseTextTemplate(src); err == nil {
+			t.Errorf("parseTextTemplate('%s') succeeded, want an error", src)
+		}
+	}
+}
+
+func TestTextTemplateString(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"short", "short"},
+		{"first\nsecond", "first..."},
+		{strings.Repeat("x", 50), strings.Repeat("x", 40) + "..."},
+	}
+	for _, tt := range tests {
+		tmpl, _ := parseTextTemplate(tt.src)
+		if got := tmpl.String(); got != tt.want {
+			t.Errorf("String of '%s' = '%s', want '%s'", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestPageRendererStyle(t *testing.T) {
+	tests := []struct {
+		yaml string
+		want *pb.Style
+	}{
+		{"", &pb.Style{Fg: "white", Bg: "black", Attr: "4"}},
+		{"{fg: red, bg: blue}", &pb.Style{Fg: "red", Bg: "blue", Attr: "4"}},
+		{"{fg: red, bg: blue, attr: '1'}", &pb.Style{Fg: "red", Bg: "blue", Attr: "1"}},
+		{"{fg: '{{if .Cookies.name}}green{{else}}orange{{end}}', bg: black}",
+			&pb.Style{Fg: "green", Bg: "black", Attr: "4"}},
+	}
+	for _, tt := range tests {
+		var ref styleRef
+		if tt.yaml != "" {
+			if err := yaml.Unmarshal([]byte(tt.yaml), &ref); err != nil {
+				t.Errorf("unmarshal '%s': %v", tt.yaml, err)
+				continue
+			}
+		}
+		if err := ref.resolve(nil); err != nil {
+			t.Errorf("resolve '%s': %v", tt.yaml, err)
+			continue
+		}
+		r := &pageRenderer{data: testTemplateData()}
+		got := r.style(ref)
+		if r.err != nil || got.Fg != tt.want.Fg || got.Bg != tt.want.Bg || got.Attr != tt.want.Attr {
+			t.Errorf("style '%s' = %v, %v, want %v", tt.yaml, got, r.err, tt.want)
+		}
+	}
+}
+
+func TestPageRendererSize(t *testing.T) {
+	tests := []struct {
+		src  string
+		want int32
+	}{
+		{"width-10", 70},
+		{"'{{.Height}}/2'", 12},
+		// sizes can't go below zero however small the client is
+		{"width-100", 0},
+		{"'{{if .Cookies.name}}width{{else}}5{{end}}'", 80},
+	}
+	for _, tt := range tests {
+		var e sizeExpr
+		if err := yaml.Unmarshal([]byte(tt.src), &e); err != nil {
+			t.Errorf("unmarshal '%s': %v", tt.src, err)
+			continue
+		}
+		r := &pageRenderer{data: testTemplateData()}
+		if got := r.size(e); r.err != nil || got != tt.want {
+			t.Errorf("size '%s' = %d, %v, want %d", tt.src, got, r.err, tt.want)
+		}
+	}
+}
+
+// TestPageRendererStickyError checks that the first error is kept and
+// later calls don't render anything
+func TestPageRendererStickyError(t *testing.T) {
+	bad, _ := parseTextTemplate("{{.Nope}}")
+	good, _ := parseTextTemplate("{{.Width}}")
+	r := &pageRenderer{data: testTemplateData()}
+	r.text(bad)
+	first := r.err
+	if first == nil {
+		t.Fatalf("no error for a template that fails")
+	}
+	if got := r.text(good); got != "" || r.err != first {
+		t.Errorf("after an error text = '%s', err = %v, want '' and %v", got, r.err, first)
+	}
+}
+
+const testPageConfig = `
+styles:
+  greeting:
+    fg: '{{if .Cookies.name}}springgreen{{else}}orange{{end}}'
+    bg: black
+pages:
+  - name: hello/{who}
+    divBoxes:
+      - name: hello
+        startX: 2
+        startY: '{{.Height}}/4'
+        width: width-4
+        height: height/2
+        borderStyle: greeting
+    textBlobs:
+      - content: "Hello {{.Params.who}}, {{.Width}}x{{.Height}}"
+        style: greeting
+        divNames: [hello]
+    keyStrokes:
+      - key: h
+        page: '{{if .Cookies.name}}greeting{{else}}home{{end}}'
+`
+
+func TestConfigPageRender(t *testing.T) {
+	var config pageConfig
+	if err := yaml.UnmarshalStrict([]byte(testPageConfig), &config); err != nil {
+		t.Fatal(err)
+	}
+	page, err := compilePage(config.Pages[0], config.Styles, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		cookies []*pb.Cookie
+		fg      string
+		link    string
+	}{
+		{nil, "orange", "home"},
+		{[]*pb.Cookie{{Key: "name", Value: "Ada"}}, "springgreen", "greeting"},
+	}
+	for _, tt := range tests {
+		preq := &pb.PageRequest{Name: "hello/bob", ClientWidth: 80, ClientHeight: 24, SendCookies: tt.cookies}
+		ctx := withRouteParams(context.Background(), map[string]string{"who": "bob"})
+		presp, err := page.render(ctx, preq)
+		if err != nil {
+			t.Errorf("render: %v", err)
+			continue
+		}
+		box := presp.DivBoxes.Boxes[0]
+		if box.StartX != 2 || box.StartY != 6 || box.Width != 76 || box.Height != 12 {
+			t.Errorf("box at %d,%d size %dx%d, want 2,6 size 76x12", box.StartX, box.StartY, box.Width, box.Height)
+		}
+		if box.BorderSt.Fg != tt.fg {
+			t.Errorf("border fg '%s', want '%s'", box.BorderSt.Fg, tt.fg)
+		}
+		if got := presp.Elements.TextBlobs[0].Content; got != "Hello bob, 80x24" {
+			t.Errorf("content '%s', want 'Hello bob, 80x24'", got)
+		}
+		link := presp.KeyStrokes[0].Action.(*pb.KeyStroke_Link).Link
+		if link.PageName != tt.link {
+			t.Errorf("link to '%s', want '%s'", link.PageName, tt.link)
+		}
+	}
+}
@@ -0,0 +1,439 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	pb "github.com/rendicott/uggly"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pageHandler is the one signature every page on this server implements. It
+// receives the request context and the client's PageRequest and returns the
+// PageResponse the client should display.
+type pageHandler func(ctx context.Context, preq *pb.PageRequest) (*pb.PageResponse, error)
+
+// pageRoute ties a page name to the handler that serves it. The pattern is
+// either an exact page name such as "form" or a pattern made of "/" separated
+// segments. A segment written as "{id}" captures whatever the request has in
+// that position as the route parameter "id" and any other segment is matched
+// with path.Match so "wizard/{id}" or "page-*" each serve a family of names.
+// The last segment may be written as "{rest...}" to capture every segment
+// from there on, "/" included, as "rest".
+//
+// Routes that set listed are advertised in the Feed with their description
+// and category, sorted by order within their category. Routes with a feed
+// function add whatever listings it returns to the Feed instead, for pages
+// that aren't known until the Feed is asked for. Routes that set
+// requireAuth are only served to peers with a verified client certificate.
+// Clients smaller than minWidth by minHeight get a page asking them to
+// enlarge their terminal instead of the page itself.
+type pageRoute struct {
+	pattern     string
+	handler     pageHandler
+	listed      bool
+	description string
+	category    string
+	order       int
+	requireAuth bool
+	minWidth    int
+	minHeight   int
+	feed        func(ctx context.Context) []*pb.PageListing
+}
+
+// listing converts the route into the PageListing clients see in the Feed.
+// PageListing has no category field so the category prefixes the description.
+func (r *pageRoute) listing() *pb.PageListing {
+	description := r.description
+	if r.category != "" {
+		description = fmt.Sprintf("[%s] %s", r.category, description)
+	}
+	return &pb.PageListing{
+		Name:        r.pattern,
+		Description: description,
+	}
+}
+
+// isPattern reports whether the route matches more than one exact name.
+func (r *pageRoute) isPattern() bool {
+	return strings.ContainsAny(r.pattern, "*?[\\{")
+}
+
+// paramName returns the parameter captured by a "{name}" pattern segment
+// or by a "{name...}" segment, in which case rest is true.
+func paramName(segment string) (name string, ok bool) {
+	name, _, ok = segmentParam(segment)
+	return name, ok
+}
+
+// segmentParam is paramName that also reports whether the segment captures
+// the rest of the name.
+func segmentParam(segment string) (name string, rest, ok bool) {
+	if len(segment) > 2 && strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+		name = segment[1 : len(segment)-1]
+		if strings.HasSuffix(name, "...") {
+			return strings.TrimSuffix(name, "..."), true, true
+		}
+		return name, false, true
+	}
+	return "", false, false
+}
+
+// match reports whether the requested page name is served by this route and
+// returns any parameters the pattern captured from it.
+func (r *pageRoute) match(name string) (map[string]string, bool) {
+	if !r.isPattern() {
+		return nil, r.pattern == name
+	}
+	patternSegments := strings.Split(r.pattern, "/")
+	nameSegments := strings.Split(name, "/")
+	last := patternSegments[len(patternSegments)-1]
+	if _, rest, _ := segmentParam(last); rest && len(nameSegments) > len(patternSegments) {
+		// fold everything the rest segment captures into its position
+		n := len(patternSegments) - 1
+		nameSegments = append(nameSegments[:n], strings.Join(nameSegments[n:], "/"))
+	}
+	if len(patternSegments) != len(nameSegments) {
+		return nil, false
+	}
+	params := make(map[string]string)
+	for i, segment := range patternSegments {
+		if param, ok := paramName(segment); ok {
+			if nameSegments[i] == "" {
+				return nil, false
+			}
+			params[param] = nameSegments[i]
+			continue
+		}
+		if ok, _ := path.Match(segment, nameSegments[i]); !ok {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// expand builds the page name that this route serves for the given
+// parameters. It is the inverse of match and is what keeps links pointed at
+// the routes that actually exist.
+func (r *pageRoute) expand(params map[string]string) (string, error) {
+	var segments []string
+	for _, segment := range strings.Split(r.pattern, "/") {
+		if param, rest, ok := segmentParam(segment); ok {
+			val := params[param]
+			if val == "" || (!rest && strings.Contains(val, "/")) {
+				return "", fmt.Errorf("route '%s' needs a value for '%s' without '/', got '%s'",
+					r.pattern, param, val)
+			}
+			segments = append(segments, val)
+			continue
+		}
+		if strings.ContainsAny(segment, "*?[\\") {
+			return "", fmt.Errorf("route '%s' can't be expanded into a single page name", r.pattern)
+		}
+		segments = append(segments, segment)
+	}
+	return strings.Join(segments, "/"), nil
+}
+
+// validate checks the parts of a route that don't depend on other routes
+func (r *pageRoute) validate() error {
+	if r.pattern == "" || r.handler == nil {
+		return fmt.Errorf("route requires a pattern and a handler")
+	}
+	segments := strings.Split(r.pattern, "/")
+	for i, segment := range segments {
+		if _, err := path.Match(segment, ""); err != nil {
+			return fmt.Errorf("bad pattern '%s': %v", r.pattern, err)
+		}
+		if _, rest, _ := segmentParam(segment); rest && i != len(segments)-1 {
+			return fmt.Errorf("bad pattern '%s': only the last segment can capture the rest", r.pattern)
+		}
+	}
+	if r.listed && r.isPattern() {
+		return fmt.Errorf("pattern '%s' can't be listed", r.pattern)
+	}
+	return nil
+}
+
+// pageRegistry holds every route the pageServer knows how to serve. Pages
+// register themselves from an init function next to their handler so that
+// adding a page never requires touching GetPage. Pages defined in config
+// files are kept apart in configRoutes so the whole set can be replaced at
+// once and so they can never shadow a page implemented in Go.
+type pageRegistry struct {
+	mu           sync.RWMutex
+	routes       []*pageRoute
+	configRoutes []*pageRoute
+	defaultPage  string
+}
+
+// pages is the registry that page handlers in this package register with
+var pages = newPageRegistry()
+
+func newPageRegistry() *pageRegistry {
+	return &pageRegistry{}
+}
+
+// register adds a route to the registry and returns it. Registering an
+// invalid pattern or a name that is already taken is a programming error
+// so it panics the same way regexp.MustCompile would.
+func (r *pageRegistry) register(route *pageRoute) *pageRoute {
+	if err := r.add(route); err != nil {
+		panic(fmt.Sprintf("pageRegistry: %v", err))
+	}
+	return route
+}
+
+// add is register for routes that come from flags rather than code, where
+// a bad route is the user's mistake and reported as an error.
+func (r *pageRegistry) add(route *pageRoute) error {
+	if err := route.validate(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.all() {
+		if existing.pattern == route.pattern {
+			return fmt.Errorf("'%s' registered twice", route.pattern)
+		}
+	}
+	r.routes = append(r.routes, route)
+	return nil
+}
+
+// setConfigRoutes replaces every route that came from config files with
+// routes. The new set is only swapped in when all of it is valid and none
+// of it collides with a registered route, otherwise the current set stays.
+func (r *pageRegistry) setConfigRoutes(routes []*pageRoute) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.checkConfigRoutes(routes); err != nil {
+		return err
+	}
+	r.configRoutes = routes
+	return nil
+}
+
+// withConfigRoutes returns a copy of the registry serving routes as its
+// config routes, so what a reload would serve can be checked before it is
+// swapped in with setConfigRoutes.
+func (r *pageRegistry) withConfigRoutes(routes []*pageRoute) (*pageRegistry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if err := r.checkConfigRoutes(routes); err != nil {
+		return nil, err
+	}
+	return &pageRegistry{
+		routes:       append([]*pageRoute(nil), r.routes...),
+		configRoutes: routes,
+		defaultPage:  r.defaultPage,
+	}, nil
+}
+
+// checkConfigRoutes reports why routes can't be the config routes. A config
+// page collides when a registered route would serve its name, since lookup
+// lets an exact config name win over a registered pattern. The caller must
+// hold mu.
+func (r *pageRegistry) checkConfigRoutes(routes []*pageRoute) error {
+	seen := make(map[string]bool)
+	for _, route := range routes {
+		if err := route.validate(); err != nil {
+			return err
+		}
+		if seen[route.pattern] {
+			return fmt.Errorf("page '%s' is defined twice", route.pattern)
+		}
+		seen[route.pattern] = true
+	}
+	for _, existing := range r.routes {
+		for _, route := range routes {
+			if _, ok := existing.match(route.pattern); ok || existing.pattern == route.pattern {
+				return fmt.Errorf("page '%s' is already served by the server itself as '%s'",
+					route.pattern, existing.pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// all returns the registered routes followed by the config routes. The
+// caller must hold mu.
+func (r *pageRegistry) all() []*pageRoute {
+	all := make([]*pageRoute, 0, len(r.routes)+len(r.configRoutes))
+	all = append(all, r.routes...)
+	return append(all, r.configRoutes...)
+}
+
+// patterns returns the pattern of every route in the registry
+func (r *pageRegistry) patterns() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var patterns []string
+	for _, route := range r.all() {
+		patterns = append(patterns, route.pattern)
+	}
+	return patterns
+}
+
+// matches reports whether glob matches the pattern of any route in the
+// registry with path.Match
+func (r *pageRegistry) matches(glob string) bool {
+	for _, pattern := range r.patterns() {
+		if ok, _ := path.Match(glob, pattern); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// setDefault sets the page name served when a PageRequest arrives without one
+func (r *pageRegistry) setDefault(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.defaultPage = name
+}
+
+// home returns the name of the page served when no name is given
+func (r *pageRegistry) home() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.defaultPage
+}
+
+// lookup finds the route for a page name along with the parameters its
+// pattern captured. Exact names always win over patterns and patterns are
+// tried in the order they were registered, registered routes before those
+// from config files.
+func (r *pageRegistry) lookup(name string) (*pageRoute, map[string]string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if name == "" {
+		name = r.defaultPage
+	}
+	all := r.all()
+	for _, route := range all {
+		if !route.isPattern() && route.pattern == name {
+			return route, nil, true
+		}
+	}
+	for _, route := range all {
+		if !route.isPattern() {
+			continue
+		}
+		if params, ok := route.match(name); ok {
+			return route, params, true
+		}
+	}
+	return nil, nil, false
+}
+
+// pageName builds the page name for the route registered under pattern.
+// Handlers build their links with this using the same pattern constant they
+// registered with so a link can never point at a route that doesn't exist.
+func (r *pageRegistry) pageName(pattern string, params map[string]string) (string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, route := range r.all() {
+		if route.pattern == pattern {
+			return route.expand(params)
+		}
+	}
+	return "", fmt.Errorf("no route registered for '%s'", pattern)
+}
+
+// routeParamsKey is the context key route parameters are stored under
+type routeParamsKey struct{}
+
+// withRouteParams returns a copy of ctx carrying the parameters of the matched route
+func withRouteParams(ctx context.Context, params map[string]string) context.Context {
+	return context.WithValue(ctx, routeParamsKey{}, params)
+}
+
+// routeParam returns the named parameter captured by the route that is
+// serving the current request or an empty string if there is none.
+func routeParam(ctx context.Context, name string) string {
+	return routeParams(ctx)[name]
+}
+
+// routeParams returns every parameter captured by the route that is serving
+// the current request, never nil.
+func routeParams(ctx context.Context) map[string]string {
+	params, _ := ctx.Value(routeParamsKey{}).(map[string]string)
+	if params == nil {
+		params = make(map[string]string)
+	}
+	return params
+}
+
+// feedFilter narrows down which listed routes end up in a FeedResponse
+type feedFilter struct {
+	category string
+	site     *site
+}
+
+// keep reports whether the route belongs in a feed built with this filter
+func (f feedFilter) keep(route *pageRoute) bool {
+	if !route.listed && route.feed == nil {
+		return false
+	}
+	if !f.site.serves(route) {
+		return false
+	}
+	return f.category == "" || f.category == route.category
+}
+
+// feedFuncTimeout is how long the feed function of a route gets to answer
+// before the feed is sent without its listings
+const feedFuncTimeout = 2 * time.Second
+
+// listings returns the PageListings of every route the filter keeps, sorted
+// by category, then by the route's declared order and finally by name so
+// the feed is stable between calls. The listings of a route with a feed
+// function take its place in that order. Feed functions are called all at
+// once, each with feedFuncTimeout, so a slow one can't hold up the others.
+func (r *pageRegistry) listings(ctx context.Context, filter feedFilter) []*pb.PageListing {
+	r.mu.RLock()
+	var kept []*pageRoute
+	for _, route := range r.all() {
+		if filter.keep(route) {
+			kept = append(kept, route)
+		}
+	}
+	r.mu.RUnlock()
+	sort.SliceStable(kept, func(i, j int) bool {
+		if kept[i].category != kept[j].category {
+			return kept[i].category < kept[j].category
+		}
+		if kept[i].order != kept[j].order {
+			return kept[i].order < kept[j].order
+		}
+		return kept[i].pattern < kept[j].pattern
+	})
+	fed := make([][]*pb.PageListing, len(kept))
+	var wg sync.WaitGroup
+	for i, route := range kept {
+		if route.feed == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, feed func(ctx context.Context) []*pb.PageListing) {
+			defer wg.Done()
+			feedCtx, cancel := context.WithTimeout(ctx, feedFuncTimeout)
+			defer cancel()
+			fed[i] = feed(feedCtx)
+		}(i, route.feed)
+	}
+	wg.Wait()
+	var listings []*pb.PageListing
+	for i, route := range kept {
+		if route.feed != nil {
+			listings = append(listings, fed[i]...)
+			continue
+		}
+		listings = append(listings, route.listing())
+	}
+	return listings
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	pb "github.com/rendicott/uggly"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func nopHandler(ctx context.Context, preq *pb.PageRequest) (*pb.PageResponse, error) {
+	return &pb.PageResponse{}, nil
+}
+
+func TestRouteMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		params  map[string]string
+		ok      bool
+	}{
+		{"form", "form", nil, true},
+		{"form", "forms", nil, false},
+		{"wizard/{id}", "wizard/abc", map[string]string{"id": "abc"}, true},
+		{"wizard/{id}", "wizard/", nil, false},
+		{"wizard/{id}", "wizard/abc/def", nil, false},
+		{"wizard/{id}", "wizards/abc", nil, false},
+		{"elixir/{id}/page/{n}", "elixir/x/page/2", map[string]string{"id": "x", "n": "2"}, true},
+		{"page-*", "page-7", map[string]string{}, true},
+		{"page-*", "page/7", nil, false},
+		{"docs/{rest...}", "docs/one", map[string]string{"rest": "one"}, true},
+		{"docs/{rest...}", "docs/hello/bob", map[string]string{"rest": "hello/bob"}, true},
+		{"docs/{rest...}", "docs/a/b/c", map[string]string{"rest": "a/b/c"}, true},
+		{"docs/{rest...}", "docs", nil, false},
+		{"docs/{rest...}", "docs/", nil, false},
+		{"docs/{rest...}", "other/one", nil, false},
+	}
+	for _, tt := range tests {
+		route := &pageRoute{pattern: tt.pattern, handler: nopHandler}
+		params, ok := route.match(tt.name)
+		if ok != tt.ok {
+			t.Errorf("'%s'.match('%s') ok = %v, want %v", tt.pattern, tt.name, ok, tt.ok)
+			continue
+		}
+		if ok && !reflect.DeepEqual(params, tt.params) {
+			t.Errorf("'%s'.match('%s') = %v, want %v", tt.pattern, tt.name, params, tt.params)
+		}
+	}
+}
+
+func TestRouteExpand(t *testing.T) {
+	tests := []struct {
+		pattern string
+		params  map[string]string
+		name    string
+		wantErr bool
+	}{
+		{"form", nil, "form", false},
+		{"wizard/{id}", map[string]string{"id": "abc"}, "wizard/abc", false},
+		{"wizard/{id}", map[string]string{}, "", true},
+		{"wizard/{id}", map[string]string{"id": "a/b"}, "", true},
+		{"elixir/{id}/page/{n}", map[string]string{"id": "x", "n": "3"}, "elixir/x/page/3", false},
+		{"page-*", nil, "", true},
+		{"docs/{rest...}", map[string]string{"rest": "hello/bob"}, "docs/hello/bob", false},
+		{"docs/{rest...}", map[string]string{}, "", true},
+	}
+	for _, tt := range tests {
+		route := &pageRoute{pattern: tt.pattern, handler: nopHandler}
+		name, err := route.expand(tt.params)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("'%s'.expand(%v) error = %v, want error %v", tt.pattern, tt.params, err, tt.wantErr)
+			continue
+		}
+		if name != tt.name {
+			t.Errorf("'%s'.expand(%v) = '%s', want '%s'", tt.pattern, tt.params, name, tt.name)
+		}
+	}
+}
+
+// TestRouteRoundTrip checks that expand is the inverse of match
+func TestRouteRoundTrip(t *testing.T) {
+	tests := []struct {
+		pattern string
+		names   []string
+	}{
+		{"wizard/{id}", []string{"wizard/abc", "wizard/9b3f"}},
+		{"elixir/{id}/page/{n}", []string{"elixir/x/page/1", "elixir/long-id/page/12"}},
+		{"{a}/{b}", []string{"x/y"}},
+		{"docs/{rest...}", []string{"docs/one", "docs/hello/bob", "docs/a/b/c/d"}},
+		{"{a}/{b...}", []string{"x/y", "x/y/z"}},
+	}
+	for _, tt := range tests {
+		route := &pageRoute{pattern: tt.pattern, handler: nopHandler}
+		for _, name := range tt.names {
+			params, ok := route.match(name)
+			if !ok {
+				t.Errorf("'%s' doesn't match '%s'", tt.pattern, name)
+				continue
+			}
+			expanded, err := route.expand(params)
+			if err != nil {
+				t.Errorf("'%s'.expand(%v): %v", tt.pattern, params, err)
+				continue
+			}
+			if expanded != name {
+				t.Errorf("'%s' round trip of '%s' gave '%s'", tt.pattern, name, expanded)
+			}
+		}
+	}
+}
+
+func TestRegisterRejectsBadRoutes(t *testing.T) {
+	tests := []struct {
+		route     *pageRoute
+		wantPanic bool
+	}{
+		{&pageRoute{pattern: "wizard/{id}", handler: nopHandler}, false},
+		{&pageRoute{pattern: "", handler: nopHandler}, true},
+		{&pageRoute{pattern: "form"}, true},
+		{&pageRoute{pattern: "bad/[", handler: nopHandler}, true},
+		{&pageRoute{pattern: "wizard/{id}", handler: nopHandler, listed: true}, true},
+	}
+	for _, tt := range tests {
+		func() {
+			defer func() {
+				if panicked := recover() != nil; panicked != tt.wantPanic {
+					t.Errorf("register('%s') panicked = %v, want %v", tt.route.pattern, panicked, tt.wantPanic)
+				}
+			}()
+			newPageRegistry().register(tt.route)
+		}()
+	}
+}
+
+func TestRouteValidate(t *testing.T) {
+	tests := []struct {
+		pattern string
+		wantErr bool
+	}{
+		{"form", false},
+		{"wizard/{id}", false},
+		{"docs/{rest...}", false},
+		{"{rest...}/page", true},
+		{"docs/{rest...}/{n}", true},
+		{"bad/[", true},
+	}
+	for _, tt := range tests {
+		route := &pageRoute{pattern: tt.pattern, handler: nopHandler}
+		if err := route.validate(); (err != nil) != tt.wantErr {
+			t.Errorf("'%s'.validate() error = %v, want error %v", tt.pattern, err, tt.wantErr)
+		}
+	}
+}
+
+func TestRegistryLookup(t *testing.T) {
+	r := newPageRegistry()
+	for _, pattern := range []string{"wizards", "wizard/{id}", "wizard/special", "docs/{rest...}"} {
+		r.register(&pageRoute{pattern: pattern, handler: nopHandler})
+	}
+	r.setDefault("wizards")
+	tests := []struct {
+		name    string
+		pattern string
+		ok      bool
+	}{
+		{"", "wizards", true},
+		{"wizard/special", "wizard/special", true},
+		{"wizard/abc", "wizard/{id}", true},
+		{"docs/a/b", "docs/{rest...}", true},
+		{"nope", "", false},
+	}
+	for _, tt := range tests {
+		route, _, ok := r.lookup(tt.name)
+		if ok != tt.ok {
+			t.Errorf("lookup('%s') ok = %v, want %v", tt.name, ok, tt.ok)
+			continue
+		}
+		if ok && route.pattern != tt.pattern {
+			t.Errorf("lookup('%s') = '%s', want '%s'", tt.name, route.pattern, tt.pattern)
+		}
+	}
+}
+
+func TestRegistryPageName(t *testing.T) {
+	r := newPageRegistry()
+	r.register(&pageRoute{pattern: "wizard/{id}", handler: nopHandler})
+	if name, err := r.pageName("wizard/{id}", map[string]string{"id": "abc"}); err != nil || name != "wizard/abc" {
+		t.Errorf("pageName = '%s', %v, want 'wizard/abc'", name, err)
+	}
+	if _, err := r.pageName("elixir/{id}", map[string]string{"id": "abc"}); err == nil {
+		t.Errorf("pageName of an unregistered pattern succeeded")
+	}
+}
+
+func TestSetConfigRoutesRejectsShadowing(t *testing.T) {
+	r := newPageRegistry()
+	for _, pattern := range []string{"form", "wizard/{id}", "docs/{rest...}"} {
+		r.register(&pageRoute{pattern: pattern, handler: nopHandler})
+	}
+	tests := []struct {
+		pattern string
+		wantErr bool
+	}{
+		{"about", false},
+		{"hello/{who}", false},
+		{"form", true},
+		{"wizard/abc", true},
+		{"wizard/{name}", true},
+		{"docs/anything/deeper", true},
+	}
+	for _, tt := range tests {
+		err := r.setConfigRoutes([]*pageRoute{{pattern: tt.pattern, handler: nopHandler}})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("setConfigRoutes('%s') error = %v, want error %v", tt.pattern, err, tt.wantErr)
+		}
+	}
+}
+
+// TestRegistryListingsFeedFuncs checks that feed functions are called side
+// by side, each with a deadline, and their listings kept in route order
+func TestRegistryListingsFeedFuncs(t *testing.T) {
+	r := newPageRegistry()
+	for _, name := range []string{"a", "b", "c"} {
+		name := name
+		r.register(&pageRoute{pattern: name, handler: nopHandler, feed: func(ctx context.Context) []*pb.PageListing {
+			deadline, ok := ctx.Deadline()
+			if !ok || time.Until(deadline) > feedFuncTimeout {
+				t.Errorf("feed of '%s' called without its own deadline", name)
+			}
+			time.Sleep(200 * time.Millisecond)
+			return []*pb.PageListing{{Name: name + "/1"}, {Name: name + "/2"}}
+		}})
+	}
+	start := time.Now()
+	listings := r.listings(context.Background(), feedFilter{})
+	if took := time.Since(start); took > 500*time.Millisecond {
+		t.Errorf("three feeds of 200ms took %v", took)
+	}
+	var names []string
+	for _, listing := range listings {
+		names = append(names, listing.Name)
+	}
+	if got, want := strings.Join(names, ","), "a/1,a/2,b/1,b/2,c/1,c/2"; got != want {
+		t.Errorf("listings %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	pb "github.com/rendicott/uggly"
+	"go.starlark.net/lib/json"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"google.golang.org/protobuf/encoding/protojson"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"runtime/metrics"
+	"sync/atomic"
+	"time"
+)
+
+// scriptDef is a page config entry that builds the page with a Starlark
+// script. The script defines page(req) which returns the PageResponse as
+// dicts and lists shaped like its protobuf JSON. req has the name, width and
+// height of the request and dicts of its cookies, form fields and route
+// params. The helpers style(fg, bg, attr="4") and char(s) stand in for
+// shelp and convertStringCharRune.
+//
+// Scripts can't load other files and have no access to the filesystem or
+// network. Each call may take at most maxSteps Starlark steps and timeout,
+// by default defaultScriptSteps and defaultScriptTimeout, and may grow the
+// heap by at most maxMemory bytes, by default defaultScriptMemory.
+type scriptDef struct {
+	File      string        `yaml:"file"`
+	MaxSteps  uint64        `yaml:"maxSteps"`
+	MaxMemory uint64        `yaml:"maxMemory"`
+	Timeout   time.Duration `yaml:"timeout"`
+}
+
+const (
+	defaultScriptSteps   = 1000000
+	defaultScriptMemory  = 64 << 20
+	defaultScriptTimeout = time.Second
+	// scriptMemoryCheck is how often the heap is looked at while a script runs
+	scriptMemoryCheck = 5 * time.Millisecond
+)
+
+// scriptPage is a compiled scriptDef
+type scriptPage struct {
+	name      string
+	file      string
+	page      starlark.Callable
+	maxSteps  uint64
+	maxMemory uint64
+	timeout   time.Duration
+}
+
+// scriptBuiltins are the names predeclared for every script
+var scriptBuiltins = starlark.StringDict{
+	"style": starlark.NewBuiltin("style", scriptStyle),
+	"char":  starlark.NewBuiltin("char", scriptChar),
+}
+
+// scriptStyle is the style builtin, shelp for scripts
+func scriptStyle(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var fg, bg string
+	attr := "4"
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "fg", &fg, "bg", &bg, "attr?", &attr); err != nil {
+		return nil, err
+	}
+	style := starlark.NewDict(3)
+	style.SetKey(starlark.String("fg"), starlark.String(fg))
+	style.SetKey(starlark.String("bg"), starlark.String(bg))
+	style.SetKey(starlark.String("attr"), starlark.String(attr))
+	return style, nil
+}
+
+// scriptChar is the char builtin, convertStringCharRune for scripts
+func scriptChar(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var s string
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "s", &s); err != nil {
+		return nil, err
+	}
+	return starlark.MakeInt(int(convertStringCharRune(s))), nil
+}
+
+// newScriptThread returns a thread that can't load modules and logs print
+func newScriptThread(name string, maxSteps uint64) *starlark.Thread {
+	thread := &starlark.Thread{
+		Name: name,
+		Print: func(thread *starlark.Thread, msg string) {
+			log.Printf("script %s: %s", thread.Name, msg)
+		},
+	}
+	thread.SetMaxExecutionSteps(maxSteps)
+	return thread
+}
+
+// heapBytes returns the bytes the heap objects of the whole process take
+func heapBytes() uint64 {
+	sample := []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return sample[0].Value.Uint64()
+}
+
+// guardScript cancels thread once ctx is done or the heap has grown by more
+// than maxMemory since the guard was started. Starlark has no way to count
+// what a thread allocates so the heap of the whole process stands in for
+// it, which is enough to stop a script before it takes the server down.
+// The returned stop has to be called once the thread is done and reports
+// whether the thread was cancelled for its memory.
+func guardScript(ctx context.Context, thread *starlark.Thread, maxMemory uint64) (stop func() bool) {
+	start := heapBytes()
+	finished := make(chan struct{})
+	var overMemory int32
+	go func() {
+		tick := time.NewTicker(scriptMemoryCheck)
+		defer tick.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				thread.Cancel("took too long")
+				return
+			case <-tick.C:
+				if heapBytes() > start+maxMemory {
+					atomic.StoreInt32(&overMemory, 1)
+					thread.Cancel("used too much memory")
+					return
+				}
+			case <-finished:
+				return
+			}
+		}
+	}()
+	return func() bool {
+		close(finished)
+		return atomic.LoadInt32(&overMemory) == 1
+	}
+}
+
+// newScriptPage runs the top level of the script of a page whose config
+// lives in dir and picks out its page function.
+func newScriptPage(name string, def scriptDef, dir string) (*scriptPage, error) {
+	if def.File == "" {
+		return nil, fmt.Errorf("page '%s': script needs a file", name)
+	}
+	file := def.File
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(dir, file)
+	}
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("page '%s': %v", name, err)
+	}
+	p := &scriptPage{
+		name:      name,
+		file:      file,
+		maxSteps:  def.MaxSteps,
+		maxMemory: def.MaxMemory,
+		timeout:   def.Timeout,
+	}
+	if p.maxSteps == 0 {
+		p.maxSteps = defaultScriptSteps
+	}
+	if p.maxMemory == 0 {
+		p.maxMemory = defaultScriptMemory
+	}
+	if p.timeout == 0 {
+		p.timeout = defaultScriptTimeout
+	}
+	// the top level is held to the same limits as every call
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+	thread := newScriptThread(name, p.maxSteps)
+	stop := guardScript(ctx, thread, p.maxMemory)
+	globals, err := starlark.ExecFile(thread, file, src, scriptBuiltins)
+	stop()
+	if err != nil {
+		return nil, fmt.Errorf("page '%s': %v", name, err)
+	}
+	page, ok := globals["page"].(starlark.Callable)
+	if !ok {
+		return nil, fmt.Errorf("page '%s': %s doesn't define a page(req) function", name, file)
+	}
+	p.page = page
+	return p, nil
+}
+
+// stringDict converts a Go map into a frozen Starlark dict
+func stringDict(m map[string]string) *starlark.Dict {
+	dict := starlark.NewDict(len(m))
+	for k, v := range m {
+		dict.SetKey(starlark.String(k), starlark.String(v))
+	}
+	dict.Freeze()
+	return dict
+}
+
+// scriptRequest is the req a script's page function is called with
+func scriptRequest(ctx context.Context, preq *pb.PageRequest) starlark.Value {
+	data := newTemplateData(ctx, preq)
+	return starlarkstruct.FromStringDict(starlark.String("request"), starlark.StringDict{
+		"name":    starlark.String(data.Page),
+		"width":   starlark.MakeInt(data.Width),
+		"height":  starlark.MakeInt(data.Height),
+		"cookies": stringDict(data.Cookies),
+		"form":    stringDict(data.Form),
+		"params":  stringDict(data.Params),
+	})
+}
+
+// serve calls the script's page function for preq. A script that runs out
+// of steps or time is reported as an upstream error, any other failure of
+// the script, running out of memory included, is a broken page and
+// reported as a plain error.
+func (p *scriptPage) serve(ctx context.Context, preq *pb.PageRequest) (*pb.PageResponse, error) {
+	thread := newScriptThread(p.name, p.maxSteps)
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	stop := guardScript(ctx, thread, p.maxMemory)
+	result, err := starlark.Call(thread, p.page, starlark.Tuple{scriptRequest(ctx, preq)}, nil)
+	if err == nil {
+		// the page is encoded on the same thread so it counts against the limits
+		result, err = starlark.Call(thread, json.Module.Members["encode"], starlark.Tuple{result}, nil)
+	}
+	if stop() {
+		return nil, fmt.Errorf("script page '%s': used more than %d bytes of memory", p.name, p.maxMemory)
+	}
+	if ctx.Err() != nil || thread.ExecutionSteps() >= p.maxSteps {
+		return nil, errUpstream(err, "The page '%s' took too long, try again in a bit.", preq.Name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("script page '%s': %v", p.name, err)
+	}
+	// unknown fields are an error so a misspelt field doesn't silently vanish
+	presp := &pb.PageResponse{}
+	encoded, _ := starlark.AsString(result)
+	if err := protojson.Unmarshal([]byte(encoded), presp); err != nil {
+		return nil, fmt.Errorf("script page '%s': page() returned no PageResponse: %v", p.name, err)
+	}
+	if presp.Name == "" {
+		presp.Name = preq.Name
+	}
+	return presp, nil
+}
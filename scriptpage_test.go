@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"errors"
+	pb "github.com/rendicott/uggly"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testScriptPage compiles a script page from src in a fresh directory
+func testScriptPage(t *testing.T, src string, def scriptDef) (*scriptPage, error) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "page.star"), []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	def.File = "page.star"
+	return newScriptPage("test", def, dir)
+}
+
+func TestNewScriptPage(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		wantErr bool
+	}{
+		{"page function", "def page(req):\n    return {}\n", false},
+		{"no page function", "x = 1\n", true},
+		{"page isn't a function", "page = 1\n", true},
+		{"syntax error", "def page(req)\n", true},
+		{"load", "load('other.star', 'x')\ndef page(req):\n    return {}\n", true},
+		{"top level fails", "fail('nope')\n", true},
+	}
+	for _, tt := range tests {
+		_, err := testScriptPage(t, tt.src, scriptDef{})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+	if _, err := newScriptPage("test", scriptDef{}, t.TempDir()); err == nil {
+		t.Errorf("script page without a file compiled")
+	}
+	if _, err := newScriptPage("test", scriptDef{File: "missing.star"}, t.TempDir()); err == nil {
+		t.Errorf("script page with a missing file compiled")
+	}
+}
+
+const testScript = `
+def page(req):
+    who = req.params.get("who", "stranger")
+    name = req.cookies.get("name", "")
+    return {
+        "elements": {"textBlobs": [{
+            "content": "hello %s/%s %dx%d %s" % (who, name, req.width, req.height, req.form.get("age", "")),
+            "style": style("red", "blue"),
+        }]},
+        "keyStrokes": [{"keyStroke": "h", "link": {"pageName": "home"}}],
+        "divBoxes": {"boxes": [{"border": True, "borderW": 1, "borderChar": char("#")}]},
+    }
+`
+
+func TestScriptPageServe(t *testing.T) {
+	p, err := testScriptPage(t, testScript, scriptDef{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	preq := &pb.PageRequest{
+		Name:         "hello/bob",
+		ClientWidth:  80,
+		ClientHeight: 24,
+		SendCookies:  []*pb.Cookie{{Key: "name", Value: "Ada"}},
+		FormData:     []*pb.FormData{{Name: "f", TextBoxData: []*pb.TextBoxData{{Name: "age", Contents: "36"}}}},
+	}
+	ctx := withRouteParams(context.Background(), map[string]string{"who": "bob"})
+	presp, err := p.serve(ctx, preq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob := presp.Elements.TextBlobs[0]
+	if got, want := blob.Content, "hello bob/Ada 80x24 36"; got != want {
+		t.Errorf("content '%s', want '%s'", got, want)
+	}
+	if blob.Style.Fg != "red" || blob.Style.Bg != "blue" || blob.Style.Attr != "4" {
+		t.Errorf("style %v, want red on blue attr 4", blob.Style)
+	}
+	if got := presp.DivBoxes.Boxes[0].BorderChar; got != '#' {
+		t.Errorf("border char %q, want '#'", got)
+	}
+	if presp.KeyStrokes[0].Action.(*pb.KeyStroke_Link).Link.PageName != "home" {
+		t.Errorf("key stroke %v, want a link to home", presp.KeyStrokes[0])
+	}
+	if presp.Name != "hello/bob" {
+		t.Errorf("name '%s', want the request's name", presp.Name)
+	}
+}
+
+func TestScriptPageFailures(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		def      scriptDef
+		upstream bool
+	}{
+		{"fails", "def page(req):\n    fail('broken')\n", scriptDef{}, false},
+		{"not a dict", "def page(req):\n    return 1\n", scriptDef{}, false},
+		{"unknown field", "def page(req):\n    return {'nope': 1}\n", scriptDef{}, false},
+		{"bad builtin args", "def page(req):\n    return {'elements': {'textBlobs': [{'style': style('red')}]}}\n", scriptDef{}, false},
+		{"out of steps", "def page(req):\n    for i in range(1000000):\n        pass\n    return {}\n",
+			scriptDef{MaxSteps: 1000}, true},
+		{"out of time", "def page(req):\n    for i in range(100000000):\n        pass\n    return {}\n",
+			scriptDef{MaxSteps: 1 << 40, Timeout: 50 * time.Millisecond}, true},
+	}
+	for _, tt := range tests {
+		p, err := testScriptPage(t, tt.src, tt.def)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		_, err = p.serve(context.Background(), &pb.PageRequest{Name: "test"})
+		if err == nil {
+			t.Errorf("%s: no error", tt.name)
+			continue
+		}
+		var perr *pageError
+		if upstream := errors.As(err, &perr) && perr.kind == errKindUpstream; upstream != tt.upstream {
+			t.Errorf("%s: upstream error = %v, want %v: %v", tt.name, upstream, tt.upstream, err)
+		}
+	}
+}
+
+// TestScriptPageFrozenRequest checks that a script can't keep state in the
+// request it's handed
+func TestScriptPageFrozenRequest(t *testing.T) {
+	p, err := testScriptPage(t, "def page(req):\n    req.cookies['x'] = '1'\n    return {}\n", scriptDef{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.serve(context.Background(), &pb.PageRequest{Name: "test"}); err == nil {
+		t.Errorf("script changed the request's cookies")
+	}
+}
+
+// hungryScript builds ever longer strings until it is stopped
+const hungryScript = `
+def hungry():
+    s = "x" * 1024
+    kept = []
+    for i in range(100000):
+        s = s + "x" * 1024
+        kept.append(s)
+    return kept
+`
+
+func TestScriptPageMemory(t *testing.T) {
+	def := scriptDef{MaxSteps: 1 << 40, MaxMemory: 4 << 20, Timeout: 10 * time.Second}
+	p, err := testScriptPage(t, hungryScript+"def page(req):\n    return {'name': str(len(hungry()))}\n", def)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	_, err = p.serve(context.Background(), &pb.PageRequest{Name: "test"})
+	if err == nil || !strings.Contains(err.Error(), "memory") {
+		t.Errorf("hungry page gave %v, want a memory error", err)
+	}
+	var perr *pageError
+	if errors.As(err, &perr) {
+		t.Errorf("hungry page gave a %v page error, want a broken page", perr.kind)
+	}
+	if took := time.Since(start); took > 2*time.Second {
+		t.Errorf("hungry page ran for %v", took)
+	}
+
+	// the top level is held to the limit too
+	if _, err := testScriptPage(t, hungryScript+"x = hungry()\n", def); err == nil || !strings.Contains(err.Error(), "memory") {
+		t.Errorf("hungry top level gave %v, want a memory error", err)
+	}
+}
@@ -7,20 +7,46 @@ import (
 	pb "github.com/rendicott/uggly"
 	"github.com/rendicott/uggo"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
 	"log"
-	"net"
 	"strings"
-	"io/ioutil"
-	"encoding/json"
-	"net/http"
+	"time"
 )
 
 var (
-	tls        = flag.Bool("tls", false, "Connection uses TLS if true, else plain TCP")
-	certFile   = flag.String("cert_file", "", "The TLS cert file")
-	keyFile    = flag.String("key_file", "", "The TLS key file")
-	port       = flag.Int("port", 10000, "The server port")
+	useTLS           = flag.Bool("tls", false, "Connection uses TLS if true, else plain TCP")
+	certFile         = flag.String("cert_file", "", "The TLS cert file")
+	keyFile          = flag.String("key_file", "", "The TLS key file")
+	clientCAFile     = flag.String("client_ca_file", "", "PEM bundle of the CAs client certificates are verified against")
+	clientAuthMode   = flag.String("client_auth", "none", "Client certificates are 'none' not asked for, 'verify' verified when given or 'require' required")
+	port             = flag.Int("port", 10000, "The server port used when no -listen address is given")
+	drainTimeout     = flag.Duration("drain_timeout", 30*time.Second, "How long in-flight requests get to finish on shutdown before the server stops hard")
+	healthInterval   = flag.Duration("health_interval", 30*time.Second, "How often the wizard source is checked for the gRPC health service")
+	enableReflection = flag.Bool("reflection", false, "Register the gRPC server reflection service")
+	interceptorList  = flag.String("interceptors", "requestid,logging,timing,recovery", "Comma separated unary interceptors to enable out of requestid, logging and timing, recovery is always on")
+	defaultPage      = flag.String("default_page", "wizards", "The page served when a PageRequest has no page name")
+	pageConfigPath   = flag.String("page_config", "", "YAML or JSON page config file, or a directory of them, served beside the built in pages")
+	execConcurrency  = flag.Int("exec_concurrency", 4, "How many programs of exec pages may run at once")
+	execTimeout      = flag.Duration("exec_timeout", 5*time.Second, "How long the program of an exec page may run when its config sets no timeout")
+	pageConfigPoll   = flag.Duration("page_config_poll", 2*time.Second, "How often -page_config is checked for changes to reload, 0 only reloads on SIGHUP")
+	sitesFile        = flag.String("sites", "", "YAML or JSON file of the sites served, each with its own hosts, pages and default page")
+	siteKey          = flag.String("site_key", "", "Metadata key clients can name their site with, empty picks sites by :authority only")
+	mountTimeout     = flag.Duration("mount_timeout", 10*time.Second, "Deadline for each call to the upstream of a -mount")
+	wizardSourceKind = flag.String("wizard_source", "http", "Where wizard data comes from, either 'http' or 'file'")
+	wizardAPIURL     = flag.String("wizard_api_url", "https://wizard-world-api.herokuapp.com", "Base URL of the Wizard World API used by the 'http' wizard source")
+	wizardFixture    = flag.String("wizard_fixture", "fixtures/wizards.json", "JSON file of wizards used by the 'file' wizard source")
+	wizardCacheTTL   = flag.Duration("wizard_cache_ttl", 5*time.Minute, "How long fetched wizard data is considered fresh, 0 disables the cache")
+	wizardTimeout    = flag.Duration("wizard_timeout", 10*time.Second, "Deadline for each call to the wizard API")
+	wizardServeStale = flag.Bool("wizard_serve_stale", true, "Serve expired wizard data while it is refreshed in the background or when refreshing fails")
+	publicHost       = flag.String("public_host", "", "Host clients reach this server on, used in generated links. Empty leaves links relative to the current server")
+	publicPort       = flag.String("public_port", "", "Port clients reach this server on, defaults to -port when -public_host is set")
+	publicTLS        = flag.Bool("public_tls", false, "Whether clients reach this server over TLS, used in generated links")
 )
 
 var loremIpsum string = `
@@ -28,48 +54,32 @@ Lorem ipsum dolor sit amet, consectetur adipiscing elit, sed do eiusmod tempor i
 
 `
 
-type Elixer struct {
-	Id string `json:"id"`
-	Name string `json:"name"`
-	Effect string `json:"effect"`
-	SideEffects string `json:"sideEffects"`
-	Characteristics string `json:"characteristics"`
-	Time string `json"time"`
-	Manufacturer string `json:"manufacturer"`
-}
-
-type Wizard struct {
-	Elixers []Elixer `json:"elixirs"`
-	Id string `json:"id"`
-	FirstName string `json:"firstName"`
-	LastName string `json:"lastName"`
-}
-
-func getWizards() (wizards []Wizard, err error) {
-	response, err := http.Get("https://wizard-world-api.herokuapp.com/Wizards")
-	if err != nil {
-		return wizards, err
-	}
-	responseData, err := ioutil.ReadAll(response.Body)
-	if err != nil {
-		return wizards, err
-	}
-	err = json.Unmarshal(responseData, &wizards)
-	if err != nil {
-		return wizards, err
-	}
-	return wizards, err
-}
-
 var strokeMap = []string{"1","2","3","4","5","6","7","8","9",
 	"a","b","c","d","e","f","g","h","i","j","k","l","m",
 	"n","o","p","q","r","s","t","u","v","w","x","y","z"}
 
-func addWizardBox(inPage *pb.PageResponse) (*pb.PageResponse, error) {
+// wizardsPageRoute serves the pages after the first of the wizards menu
+const wizardsPageRoute = "wizards/page/{n}"
+
+func addWizardBox(ctx context.Context, inPage *pb.PageResponse, menuPage, height int) (*pb.PageResponse, error) {
 	var err error
 	// first grab content so we can size boxes right
-	wizards, err := getWizards()
+	wizards, err := getWizards(ctx)
+	if err != nil { return inPage, err }
+	var items []menuItem
+	for _, wiz := range(wizards) {
+		link, err := pages.link(wizardRoute, map[string]string{"id": wiz.Id})
+		if err != nil { return inPage, err }
+		items = append(items, menuItem{
+			label: fmt.Sprintf("%s %s", wiz.FirstName, wiz.LastName),
+			link: link,
+		})
+	}
+	// the box starts at row 3 and needs a title line and a pager line
+	wizardMenu := newMenu(items, menuKeys(), height-8, routePageLink(wizardsPageRoute, nil))
+	menuContent, err := wizardMenu.render(inPage, menuPage)
 	if err != nil { return inPage, err }
+	contentString := fmt.Sprintf("  WIZARDS  \n", ) + menuContent
 	inPage.DivBoxes.Boxes = append(inPage.DivBoxes.Boxes, &pb.DivBox{
 		Name:     "wizards",
 		Border:   false,
@@ -77,30 +87,13 @@ func addWizardBox(inPage *pb.PageResponse) (*pb.PageResponse, error) {
 		StartX:   3,
 		StartY:   3,
 		Width:    int32(30),
-		Height:   int32(len(wizards)+3),
+		Height:   int32(strings.Count(contentString, "\n")+3),
 		FillSt: &pb.Style{
 			Fg:   "grey",
 			Bg:   "black",
 			Attr: "4",
 		},
 	})
-	contentString := fmt.Sprintf("  WIZARDS  \n", )
-	lmap := make(map[string]string)
-	for i, wiz := range(wizards) {
-		name := fmt.Sprintf("%s %s", wiz.FirstName, wiz.LastName)
-		lmap[name] = strokeMap[i]
-	}
-	for name, stroke := range lmap {
-		inPage.KeyStrokes = append(inPage.KeyStrokes, &pb.KeyStroke{
-			KeyStroke: stroke,
-			Action: &pb.KeyStroke_Link{
-				Link: &pb.Link{
-					PageName: name,
-					Server: "localhost",
-					Port: "8888",
-			}}})
-		contentString += fmt.Sprintf("(%s) %s\n", stroke, name)
-	}
 	inPage.Elements.TextBlobs = append(inPage.Elements.TextBlobs, &pb.TextBlob{
 		Content: contentString,
 		Wrap:    true,
@@ -114,11 +107,10 @@ func addWizardBox(inPage *pb.PageResponse) (*pb.PageResponse, error) {
 	return inPage, err
 }
 
-func okay(preq *pb.PageRequest) (*pb.PageResponse,error) {
+func okay(ctx context.Context, preq *pb.PageRequest) (*pb.PageResponse,error) {
 	var err error
 	height := int(preq.ClientHeight)
 	width := int(preq.ClientWidth)
-	log.Printf("func ok height %d, width %d", height, width)
 	links := []*uggo.PageLink{
 		&uggo.PageLink{
 			Page: "one",
@@ -141,7 +133,26 @@ func okay(preq *pb.PageRequest) (*pb.PageResponse,error) {
 		width, height, links,preq.Name,okContent[preq.Name]), err
 }
 
-func wizards(preq *pb.PageRequest) (presp *pb.PageResponse, err error) {
+func init() {
+	for i, name := range []string{"one", "two", "three", "four"} {
+		pages.register(&pageRoute{
+			pattern:     name,
+			handler:     okay,
+			listed:      true,
+			description: okDescriptions[name],
+			category:    "docs",
+			order:       i,
+			minWidth:    40,
+			minHeight:   10,
+		})
+	}
+}
+
+func wizards(ctx context.Context, preq *pb.PageRequest) (presp *pb.PageResponse, err error) {
+	menuPage, err := parseMenuPage(routeParam(ctx, "n"))
+	if err != nil {
+		return nil, err
+	}
 	height := int(preq.ClientHeight)
 	width := int(preq.ClientWidth)
 	localPage := pb.PageResponse{
@@ -163,10 +174,23 @@ func wizards(preq *pb.PageRequest) (presp *pb.PageResponse, err error) {
 			Attr: "4",
 		},
 	})
-	finalPage, err := addWizardBox(&localPage)
+	finalPage, err := addWizardBox(ctx, &localPage, menuPage, height)
 	return finalPage, err
 }
 
+func init() {
+	pages.register(&pageRoute{
+		pattern:     "wizards",
+		handler:     wizards,
+		listed:      true,
+		description: "Wizards from the Wizard World API",
+		category:    "wizards",
+		minWidth:    40,
+		minHeight:   12,
+	})
+	pages.register(&pageRoute{pattern: wizardsPageRoute, handler: wizards, minWidth: 40, minHeight: 12})
+}
+
 func flipFlopColor(num int) (string) {
 	if num%2 == 0 {
 		return "darkslategrey"
@@ -238,6 +262,12 @@ func formSubmit(ctx context.Context, preq *pb.PageRequest) (presp *pb.PageRespon
 	return &localPage, err
 }
 
+func init() {
+	// formSubmit is only reached through the form's SubmitLink. Its box
+	// leaves a margin of 10 columns and 15 rows around the message.
+	pages.register(&pageRoute{pattern: "formSubmit", handler: formSubmit, minWidth: 30, minHeight: 20})
+}
+
 func form(ctx context.Context, preq *pb.PageRequest) (presp *pb.PageResponse, err error) {
 	height := int(preq.ClientHeight)
 	width := int(preq.ClientWidth)
@@ -250,7 +280,6 @@ func form(ctx context.Context, preq *pb.PageRequest) (presp *pb.PageResponse, er
 	var name string
 	var age string
 	for _, cookie := range preq.SendCookies {
-		log.Printf("got cookie from client key = '%s', val = '%s'", cookie.Key, cookie.Value)
 		if cookie.Key == "name" {
 			name = cookie.Value
 		}
@@ -274,12 +303,18 @@ func form(ctx context.Context, preq *pb.PageRequest) (presp *pb.PageResponse, er
 		BorderSt: shelp("orange", "black"),
 		FillSt: shelp("white","black"),
 	})
+	if identity, ok := peerIdentity(ctx); ok {
+		// a verified certificate beats whatever the name cookie says
+		name = identity.name()
+		welcomeMessage = fmt.Sprintf("hi %s, your certificate says who you are but not how old you are", name)
+		if age != "" {
+			welcomeMessage = fmt.Sprintf("Welcome back %s, are you still %s", name, age)
+		}
+	}
 	localPage.Elements.Forms = append(localPage.Elements.Forms, &pb.Form{
 		Name: "test",
 		DivName: "formDiv",
-		SubmitLink: &pb.Link{
-			PageName: "formSubmit",
-		},
+		SubmitLink: localLink("formSubmit"),
 		TextBoxes: []*pb.TextBox{
 			&pb.TextBox{
 				Name: "name",
@@ -329,19 +364,27 @@ func form(ctx context.Context, preq *pb.PageRequest) (presp *pb.PageResponse, er
 		},
 		DivNames: []string{"formDiv"},
 	})
-	md, ok := metadata.FromIncomingContext(ctx)
-	if ok {
-		log.Printf("form got incoming metadata: %v", md)
-	} else {
-		log.Print("form no metadata received")
-	}
 	return &localPage, err
 }
 
-func wacky(preq *pb.PageRequest) (presp *pb.PageResponse, err error) {
+func init() {
+	pages.register(&pageRoute{
+		pattern:     "form",
+		handler:     form,
+		listed:      true,
+		description: "Form demo that remembers you with cookies",
+		category:    "demo",
+		order:       2,
+		// the text boxes end 55 columns and 13 rows into a box that leaves
+		// a margin of 10 columns and 15 rows
+		minWidth:  70,
+		minHeight: 30,
+	})
+}
+
+func wacky(ctx context.Context, preq *pb.PageRequest) (presp *pb.PageResponse, err error) {
 	height := int(preq.ClientHeight)
 	width := int(preq.ClientWidth)
-	log.Printf("got new client width, height: %d, %d\n", width, height)
 	cellWidth := width / 7
 	cellHeight := height / 6
 	localPage := pb.PageResponse{
@@ -403,36 +446,71 @@ func wacky(preq *pb.PageRequest) (presp *pb.PageResponse, err error) {
 	return &localPage, err
 }
 
+func init() {
+	pages.register(&pageRoute{
+		pattern:     "home",
+		handler:     wacky,
+		listed:      true,
+		description: "Checkerboard of resizable boxes",
+		category:    "demo",
+		order:       1,
+		// below 7 columns or 6 rows the cells have no size at all
+		minWidth:  14,
+		minHeight: 12,
+	})
+}
+
 /* GetPage implements the Page Service's GetPage method as required in the protobuf definition.
 
 It is the primary listening method for the server. It accepts a PageRequest and then attempts to build
-a PageResponse which the client will process and display on the client's pcreen. 
+a PageResponse which the client will process and display on the client's pcreen. The handler for
+the page is looked up in the server's pageRegistry. Errors are answered with the gRPC status of
+their kind carrying an error PageResponse in its details, see pageErrorStatus.
 */
 func (s pageServer) GetPage(ctx context.Context, preq *pb.PageRequest) (presp *pb.PageResponse, err error) {
-	md, ok := metadata.FromIncomingContext(ctx)
-	if ok {
-		log.Printf("got incoming metadata: %v", md)
-	} else {
-		log.Print("no metadata received")
-	}
-	if preq.Name == "home" {
-		return wacky(preq)
-	} else if preq.Name == "form" {
-		return form(ctx, preq)
-	} else if preq.Name == "formSubmit" {
-		return formSubmit(ctx, preq)
-	} else if preq.Name == "one" || preq.Name == "two" || preq.Name == "three" || preq.Name == "four" {
-		return okay(preq)
-	} else {
-		return wizards(preq)
+	presp, err = s.servePage(ctx, preq)
+	if err != nil {
+		return nil, pageErrorStatus(ctx, preq, err)
+	}
+	return presp, err
+}
+
+// servePage looks up the route for the request among the pages of the
+// client's site and calls its handler
+func (s pageServer) servePage(ctx context.Context, preq *pb.PageRequest) (*pb.PageResponse, error) {
+	if err := validateDimensions(preq); err != nil {
+		return nil, err
+	}
+	site, err := siteFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if preq.Name == "" {
+		// handlers see the page they serve, not an empty name
+		preq.Name = site.home(s.registry)
 	}
+	route, params, ok := site.lookup(s.registry, preq.Name)
+	if !ok {
+		return nil, errNotFound("This server has no page named '%s'.", preq.Name)
+	}
+	if route.requireAuth {
+		if _, ok := peerIdentity(ctx); !ok {
+			return nil, errUnauthorized("The page '%s' is only served to clients with a verified certificate.", preq.Name)
+		}
+	}
+	if !route.fits(preq) {
+		return enlargeTerminalPage(preq, route.minWidth, route.minHeight), nil
+	}
+	return route.handler(withRouteParams(ctx, params), preq)
 }
 
-/* newPageServer takes the loaded pageconfig YAML and converts it to the structs
+/* newPageServer takes the registry of page routes and wraps it in the structs
 required so that the GetPage method can adequately respond with a PageResponse.
 */
-func newPageServer() *pageServer {
-	pServer := &pageServer{}
+func newPageServer(registry *pageRegistry) *pageServer {
+	pServer := &pageServer{
+		registry: registry,
+	}
 	return pServer
 }
 
@@ -442,7 +520,7 @@ as defined in the protobuf definition
 */
 type pageServer struct {
 	pb.UnimplementedPageServer
-	//pages []*pageServerPage
+	registry *pageRegistry
 }
 
 // convertStringCharRune takes a string and converts it to a rune slice
@@ -463,39 +541,41 @@ as defined in the protobuf definition
 */
 type feedServer struct {
 	pb.UnimplementedFeedServer
-	pages []*pb.PageListing
+	registry *pageRegistry
 }
 
 /* newFeedServer generates a feed of pages this server wants to expose in an
-index to a client that requests it
+index to a client that requests it. The feed is built from the routes in the
+registry that declared themselves as listed so it can't drift from what GetPage
+actually serves.
 */
-func newFeedServer() *feedServer {
-	fServer := &feedServer{}
-	// ./server.go:82:17: first argument to append must be slice; have *uggly.Pages
-	fServer.pages = append(fServer.pages, &pb.PageListing{
-		Name: "wizards",
-	})
-	fServer.pages = append(fServer.pages, &pb.PageListing{
-		Name: "home",
-	})
-	fServer.pages = append(fServer.pages, &pb.PageListing{
-		Name: "form",
-	})
-	fServer.pages = append(fServer.pages, &pb.PageListing{
-		Name: "one",
-	})
-	fServer.pages = append(fServer.pages, &pb.PageListing{
-		Name: "two",
-	})
-	fServer.pages = append(fServer.pages, &pb.PageListing{
-		Name: "three",
-	})
-	fServer.pages = append(fServer.pages, &pb.PageListing{
-		Name: "four",
-	})
+func newFeedServer(registry *pageRegistry) *feedServer {
+	fServer := &feedServer{
+		registry: registry,
+	}
 	return fServer
 }
 
+// feedCategoryKey is the metadata key a client can send to only receive the
+// listings of a single category. FeedRequest itself carries nothing but the
+// reserved sendData flag so metadata is the only place a filter can come from.
+const feedCategoryKey = "feed-category"
+
+// newFeedFilter builds the filter for a GetFeed call from what the request carries
+func newFeedFilter(ctx context.Context, freq *pb.FeedRequest) (feedFilter, error) {
+	site, err := siteFor(ctx)
+	if err != nil {
+		return feedFilter{}, err
+	}
+	filter := feedFilter{site: site}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if vals := md.Get(feedCategoryKey); len(vals) > 0 {
+			filter.category = vals[0]
+		}
+	}
+	return filter, nil
+}
+
 /* GetFeed implements the Feed Service's GetFeed method as required in the protobuf definition.
 
 It is the primary listening method for the server. It accepts a FeedRequest and then attempts to build
@@ -503,31 +583,117 @@ a FeedResponse which the client will process.
 */
 func (f feedServer) GetFeed(ctx context.Context, freq *pb.FeedRequest) (fresp *pb.FeedResponse, err error) {
 	fresp = &pb.FeedResponse{}
-	fresp.Pages = f.pages
+	filter, err := newFeedFilter(ctx, freq)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	fresp.Pages = filter.site.listings(ctx, f.registry, filter)
 	return fresp, err
 }
 
 
 func main() {
 	flag.Parse()
+	if *healthInterval <= 0 {
+		// time.Tick would hand back a nil channel and freeze the health status
+		log.Fatalf("-health_interval must be positive, got %v", *healthInterval)
+	}
 	genOkContent()
-	//lis, err := net.Listen("tcp", fmt.Sprintf("0.0.0.0:%d", *port))
-	lis, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", *port))
+	selfAddress = newSelfAddress(*publicHost, *publicPort, *publicTLS, *port)
+	var err error
+	wizardData, err = newWizardSource(*wizardSourceKind, *wizardAPIURL, *wizardFixture, *wizardTimeout)
+	if err != nil {
+		log.Fatalf("failed to set up wizard source: %v", err)
+	}
+	if *wizardCacheTTL > 0 {
+		wizardData = newCachedWizardSource(wizardData, *wizardCacheTTL, *wizardServeStale)
+	}
+	addrs := []string(listenAddrs)
+	if len(addrs) == 0 {
+		addrs = defaultListenAddrs(*port)
+	}
+	listeners, err := openListeners(addrs)
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
 	var opts []grpc.ServerOption
+	chain, err := unaryInterceptors(*interceptorList)
+	if err != nil {
+		log.Fatalf("failed to set up interceptors: %v", err)
+	}
+	opts = append(opts, grpc.ChainUnaryInterceptor(chain...))
+	if *useTLS {
+		clientAuth, err := parseClientAuth(*clientAuthMode, *clientCAFile)
+		if err != nil {
+			log.Fatalf("failed to set up TLS: %v", err)
+		}
+		certs, err := newCertReloader(*certFile, *keyFile, *clientCAFile)
+		if err != nil {
+			log.Fatalf("failed to set up TLS: %v", err)
+		}
+		watchReloadSignal("TLS certificates", certs.reload)
+		opts = append(opts, grpc.Creds(credentials.NewTLS(serverTLSConfig(certs, clientAuth))))
+	} else if *clientAuthMode != "none" {
+		log.Fatalf("-client_auth '%s' requires -tls", *clientAuthMode)
+	}
 	grpcServer := grpc.NewServer(opts...)
-	f := newFeedServer()
+	f := newFeedServer(pages)
 	pb.RegisterFeedServer(grpcServer, *f)
-	s := newPageServer()
+	if err := addMounts(pages, mountSpecs, *mountTimeout); err != nil {
+		log.Fatalf("failed to mount: %v", err)
+	}
+	execPages = newExecRunner(*execConcurrency, *execTimeout)
+	var loadPages func() error
+	if *pageConfigPath != "" {
+		// sites is still nil for the first load, reloads may not break a site
+		loadPages = pageConfigLoader(pages, *pageConfigPath, func(candidate *pageRegistry) error {
+			return sites.check(candidate)
+		})
+		if err := loadPages(); err != nil {
+			log.Fatalf("failed to load page config: %v", err)
+		}
+	}
+	pages.setDefault(*defaultPage)
+	if *sitesFile != "" {
+		sites, err = loadSites(*sitesFile, *siteKey, pages)
+		if err != nil {
+			log.Fatalf("failed to load sites: %v", err)
+		}
+		for _, s := range sites.sites {
+			if s.load != nil {
+				watchPageConfigReloads("page config of site "+s.name, s.pageConfig, *pageConfigPoll, s.load)
+			}
+		}
+	}
+	if loadPages != nil {
+		watchPageConfigReloads("page config", *pageConfigPath, *pageConfigPoll, loadPages)
+	}
+	s := newPageServer(pages)
 	pb.RegisterPageServer(grpcServer, *s)
-	log.Println("Server listening")
-	grpcServer.Serve(lis)
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+	watchSourceHealth(healthServer, wizardData, *healthInterval, *wizardTimeout)
+	if *enableReflection {
+		reflection.Register(grpcServer)
+	}
+	stopped := shutdownOnSignal(grpcServer, *drainTimeout, healthServer.Shutdown)
+	if err := serveAll(grpcServer.Serve, listeners); err != nil {
+		log.Fatalf("failed to serve: %v", err)
+	}
+	<-stopped
+	log.Print("Server stopped")
 }
 
 var okContent map[string]string
 
+// okDescriptions are the Feed descriptions of the pages served by okay
+var okDescriptions = map[string]string{
+	"one":   "3pocalypse explained with a non-technical analogy",
+	"two":   "3pocalypse technical synopsis",
+	"three": "Placeholder page three",
+	"four":  "Placeholder page four",
+}
+
 func genOkContent() {
 	okContent = make(map[string]string)
 	okContent["one"] = `If you're already familiar with networking then you can jump to the [technical explanation](./3pocalypse-primer) this part or re-read for a refresher.
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"google.golang.org/grpc"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// watchReloadSignal calls reload every time the process receives SIGHUP so
+// that what is named by what can be refreshed without a restart. Errors are
+// logged and the server keeps running with whatever it had before.
+func watchReloadSignal(what string, reload func() error) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			if err := reload(); err != nil {
+				log.Printf("SIGHUP: failed to reload %s, keeping the current one: %v", what, err)
+				continue
+			}
+			log.Printf("SIGHUP: reloaded %s", what)
+		}
+	}()
+}
+
+// shutdownOnSignal stops server gracefully when the process receives SIGINT
+// or SIGTERM. beforeDrain is called first so health checks can report the
+// server as going away, then the listeners are closed and in-flight RPCs get
+// up to drainTimeout to finish before the server is stopped hard. A second
+// signal while draining stops it hard immediately. The returned channel is
+// closed once the server has stopped so main can wait for the drain to
+// finish after Serve has returned.
+func shutdownOnSignal(server *grpc.Server, drainTimeout time.Duration, beforeDrain func()) <-chan struct{} {
+	stopped := make(chan struct{})
+	term := make(chan os.Signal, 2)
+	signal.Notify(term, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		defer close(stopped)
+		sig := <-term
+		log.Printf("%s: shutting down, draining in-flight requests for up to %s", sig, drainTimeout)
+		beforeDrain()
+		drained := make(chan struct{})
+		go func() {
+			server.GracefulStop()
+			close(drained)
+		}()
+		select {
+		case <-drained:
+			log.Print("shutdown: all requests drained")
+		case <-time.After(drainTimeout):
+			log.Printf("shutdown: requests still running after %s, stopping hard", drainTimeout)
+			server.Stop()
+		case sig := <-term:
+			log.Printf("%s: stopping hard without waiting for the drain", sig)
+			server.Stop()
+		}
+	}()
+	return stopped
+}
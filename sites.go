@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	pb "github.com/rendicott/uggly"
+	"google.golang.org/grpc/metadata"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"net"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// siteConfig is the file -sites points at
+type siteConfig struct {
+	Sites []siteDef `yaml:"sites"`
+}
+
+// siteDef is one site in a siteConfig. A site is picked by the host the
+// client connected to, which is matched against hosts with path.Match so
+// "*.example.com" works, or by name through the -site_key metadata. It
+// serves the pages whose route pattern matches one of pages, again with
+// path.Match so "wizard/*" covers "wizard/{id}", and sends requests without
+// a page name to defaultPage. The fallback site serves clients no other site
+// claims, without one they are turned away.
+//
+// A site with pageConfig has a page set of its own, loaded from that page
+// config file or directory the way -page_config is and reloaded with it.
+// Only that site serves those pages, so two sites can each have their own
+// page under the same name.
+type siteDef struct {
+	Name        string   `yaml:"name"`
+	Hosts       []string `yaml:"hosts"`
+	DefaultPage string   `yaml:"defaultPage"`
+	Pages       []string `yaml:"pages"`
+	PageConfig  string   `yaml:"pageConfig"`
+	Fallback    bool     `yaml:"fallback"`
+}
+
+// site is a loaded siteDef. A nil *site is the whole server, which is what
+// every request gets when no sites are configured. own holds the pages of
+// the site's pageConfig and load reloads them, both are nil without one.
+type site struct {
+	name        string
+	hosts       []string
+	defaultPage string
+	pages       []string
+	pageConfig  string
+	own         *pageRegistry
+	load        func() error
+}
+
+// serves reports whether route, one of the shared pages, is part of the site
+func (s *site) serves(route *pageRoute) bool {
+	if s == nil {
+		return true
+	}
+	for _, glob := range s.pages {
+		if ok, _ := path.Match(glob, route.pattern); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// home returns the page served to the site's clients when no name is given
+func (s *site) home(registry *pageRegistry) string {
+	if s == nil || s.defaultPage == "" {
+		return registry.home()
+	}
+	return s.defaultPage
+}
+
+// lookup finds the route for name among the site's own pages and then the
+// shared pages of registry it serves
+func (s *site) lookup(registry *pageRegistry, name string) (*pageRoute, map[string]string, bool) {
+	if s == nil {
+		return registry.lookup(name)
+	}
+	return s.lookupIn(registry, s.own, name)
+}
+
+// lookupIn is lookup with own standing in for the site's own pages
+func (s *site) lookupIn(registry, own *pageRegistry, name string) (*pageRoute, map[string]string, bool) {
+	if own != nil {
+		if route, params, ok := own.lookup(name); ok {
+			return route, params, true
+		}
+	}
+	route, params, ok := registry.lookup(name)
+	if !ok || !s.serves(route) {
+		return nil, nil, false
+	}
+	return route, params, true
+}
+
+// listings returns the feed of the site, its own pages the filter keeps
+// followed by the shared pages of registry the filter keeps
+func (s *site) listings(ctx context.Context, registry *pageRegistry, filter feedFilter) []*pb.PageListing {
+	shared := registry.listings(ctx, filter)
+	if s == nil || s.own == nil {
+		return shared
+	}
+	return append(s.own.listings(ctx, feedFilter{category: filter.category}), shared...)
+}
+
+// check reports why the site can't serve out of registry with own as its
+// own pages. Every glob in pages has to match a shared page, its own pages
+// can't take the name of a shared page it serves and it has to serve its
+// default page, otherwise its clients would land on a page they can't see
+// whenever they ask for no page or head back home.
+func (s *site) check(registry, own *pageRegistry) error {
+	for _, glob := range s.pages {
+		if !registry.matches(glob) {
+			return fmt.Errorf("site '%s': pages '%s' matches no page", s.name, glob)
+		}
+	}
+	if own != nil {
+		for _, pattern := range own.patterns() {
+			if route, _, ok := registry.lookup(pattern); ok && s.serves(route) {
+				return fmt.Errorf("site '%s': page '%s' is already one of its shared pages as '%s'",
+					s.name, pattern, route.pattern)
+			}
+		}
+	}
+	home := s.home(registry)
+	if _, _, ok := s.lookupIn(registry, own, home); !ok {
+		return fmt.Errorf("site '%s' doesn't serve its default page '%s'", s.name, home)
+	}
+	return nil
+}
+
+// siteTable picks the site of a request. key is the metadata key a client
+// can name its site with, it is only looked at when set.
+type siteTable struct {
+	sites    []*site
+	fallback *site
+	key      string
+}
+
+// sites is the table every request is matched against, nil serves every
+// page to everyone. main sets it from -sites.
+var sites *siteTable
+
+// check reports why a site of the table can't serve out of registry, it is
+// how a reload of the shared pages is kept from breaking a site
+func (t *siteTable) check(registry *pageRegistry) error {
+	if t == nil {
+		return nil
+	}
+	for _, s := range t.sites {
+		if err := s.check(registry, s.own); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadSites reads the site config at file and loads the page config of
+// every site that has one, relative to file. Every site has to pass check
+// against the shared pages of registry.
+func loadSites(file, key string, registry *pageRegistry) (*siteTable, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var config siteConfig
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	table := &siteTable{key: key}
+	seen := make(map[string]bool)
+	for _, def := range config.Sites {
+		if def.Name == "" {
+			return nil, fmt.Errorf("%s: site without a name", file)
+		}
+		if seen[def.Name] {
+			return nil, fmt.Errorf("%s: site '%s' is defined twice", file, def.Name)
+		}
+		seen[def.Name] = true
+		if len(def.Pages) == 0 && def.PageConfig == "" {
+			return nil, fmt.Errorf("%s: site '%s' has no pages", file, def.Name)
+		}
+		for _, glob := range append(def.Hosts, def.Pages...) {
+			if _, err := path.Match(glob, ""); err != nil {
+				return nil, fmt.Errorf("%s: site '%s': bad pattern '%s': %v", file, def.Name, glob, err)
+			}
+		}
+		s := &site{
+			name:        def.Name,
+			defaultPage: def.DefaultPage,
+			pages:       def.Pages,
+		}
+		for _, host := range def.Hosts {
+			s.hosts = append(s.hosts, strings.ToLower(host))
+		}
+		if def.PageConfig != "" {
+			s.pageConfig = def.PageConfig
+			if !filepath.IsAbs(s.pageConfig) {
+				s.pageConfig = filepath.Join(filepath.Dir(file), s.pageConfig)
+			}
+			s.own = newPageRegistry()
+			s.load = pageConfigLoader(s.own, s.pageConfig, func(own *pageRegistry) error {
+				return s.check(registry, own)
+			})
+			if err := s.load(); err != nil {
+				return nil, fmt.Errorf("%s: site '%s': %v", file, s.name, err)
+			}
+		} else if err := s.check(registry, nil); err != nil {
+			return nil, fmt.Errorf("%s: %v", file, err)
+		}
+		if def.Fallback {
+			if table.fallback != nil {
+				return nil, fmt.Errorf("%s: both '%s' and '%s' are the fallback site", file, table.fallback.name, s.name)
+			}
+			table.fallback = s
+		}
+		table.sites = append(table.sites, s)
+	}
+	if len(table.sites) == 0 {
+		return nil, fmt.Errorf("%s: no sites", file)
+	}
+	return table, nil
+}
+
+// byName returns the site called name
+func (t *siteTable) byName(name string) (*site, bool) {
+	for _, s := range t.sites {
+		if s.name == name {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+// byHost returns the first site that has host, which may carry a port
+func (t *siteTable) byHost(host string) (*site, bool) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	for _, s := range t.sites {
+		for _, glob := range s.hosts {
+			if ok, _ := path.Match(glob, host); ok {
+				return s, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// siteFor returns the site of the request behind ctx. A site named in the
+// -site_key metadata wins over the :authority the client connected to.
+func siteFor(ctx context.Context) (*site, error) {
+	if sites == nil {
+		return nil, nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	if sites.key != "" {
+		if vals := md.Get(sites.key); len(vals) > 0 {
+			if s, ok := sites.byName(vals[0]); ok {
+				return s, nil
+			}
+			return nil, errNotFound("This server has no site named '%s'.", vals[0])
+		}
+	}
+	authority := ""
+	if vals := md.Get(":authority"); len(vals) > 0 {
+		authority = vals[0]
+		if s, ok := sites.byHost(authority); ok {
+			return s, nil
+		}
+	}
+	if sites.fallback != nil {
+		return sites.fallback, nil
+	}
+	return nil, errNotFound("This server has no site for '%s'.", authority)
+}
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	pb "github.com/rendicott/uggly"
+	"google.golang.org/grpc/metadata"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testSiteConfig = `
+sites:
+  - name: wizards
+    hosts: [wizards.example, "*.wizards.example"]
+    defaultPage: wizards
+    pages: [wizards, "wizard/*"]
+  - name: docs
+    hosts: [Docs.Example]
+    defaultPage: about
+    pages: [about, "docs/*"]
+    fallback: true
+`
+
+// testSites loads the site config src with "site" as the site key over
+// the pages of testSiteRegistry
+func testSites(t *testing.T, src string) (*siteTable, error) {
+	t.Helper()
+	return loadTestSites(t, t.TempDir(), src, testSiteRegistry())
+}
+
+// loadTestSites writes the site config src to dir and loads it over registry
+func loadTestSites(t *testing.T, dir, src string, registry *pageRegistry) (*siteTable, error) {
+	t.Helper()
+	file := filepath.Join(dir, "sites.yaml")
+	writeTestFile(t, file, src)
+	return loadSites(file, "site", registry)
+}
+
+// writeTestFile writes content to file
+func writeTestFile(t *testing.T, file, content string) {
+	t.Helper()
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// textPageConfig is a page config of pages that each show their text
+func textPageConfig(pages map[string]string) string {
+	var b strings.Builder
+	b.WriteString("pages:\n")
+	for name, text := range pages {
+		fmt.Fprintf(&b, "  - name: %s\n    listed: true\n    textBlobs:\n      - content: %s\n", name, text)
+	}
+	return b.String()
+}
+
+// withSites makes table the sites of the server until the test is done
+func withSites(t *testing.T, table *siteTable) {
+	t.Helper()
+	saved := sites
+	sites = table
+	t.Cleanup(func() { sites = saved })
+}
+
+// siteContext is an incoming call to authority with the metadata kv
+func siteContext(authority string, kv ...string) context.Context {
+	md := metadata.Pairs(kv...)
+	if authority != "" {
+		md.Set(":authority", authority)
+	}
+	return metadata.NewIncomingContext(context.Background(), md)
+}
+
+func TestLoadSites(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		wantErr bool
+	}{
+		{"valid", "sites:\n  - {name: a, pages: [form]}\n", false},
+		{"no sites", "sites: []\n", true},
+		{"no name", "sites:\n  - pages: [form]\n", true},
+		{"twice", "sites:\n  - {name: a, pages: [form]}\n  - {name: a, pages: [form]}\n", true},
+		{"no pages", "sites:\n  - {name: a}\n", true},
+		{"bad glob", "sites:\n  - {name: a, pages: [form, '[']}\n", true},
+		{"glob matches nothing", "sites:\n  - {name: a, pages: [form, 'news/*']}\n", true},
+		{"two fallbacks", "sites:\n  - {name: a, pages: [form], fallback: true}\n  - {name: b, pages: [form], fallback: true}\n", true},
+		{"unknown field", "sites:\n  - {name: a, pages: [form], page: b}\n", true},
+		// the server's default page is form, which b doesn't serve
+		{"server default not served", "sites:\n  - {name: b, pages: [about]}\n", true},
+		{"default not served", "sites:\n  - {name: a, pages: [form], defaultPage: about}\n", true},
+		{"default not registered", "sites:\n  - {name: a, pages: ['*'], defaultPage: nope}\n", true},
+	}
+	for _, tt := range tests {
+		if _, err := testSites(t, tt.src); (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSiteByHost(t *testing.T) {
+	table, err := testSites(t, testSiteConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		host string
+		site string
+	}{
+		{"wizards.example", "wizards"},
+		{"wizards.example:10000", "wizards"},
+		{"WIZARDS.example", "wizards"},
+		{"eu.wizards.example", "wizards"},
+		{"eu.wizards.example:443", "wizards"},
+		{"docs.example", "docs"},
+		{"docs.EXAMPLE:10000", "docs"},
+		{"wizards.example.org", ""},
+		{"other.example", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		s, ok := table.byHost(tt.host)
+		if ok != (tt.site != "") || (ok && s.name != tt.site) {
+			t.Errorf("byHost('%s') = %v, %v, want '%s'", tt.host, s, ok, tt.site)
+		}
+	}
+}
+
+func TestSiteFor(t *testing.T) {
+	table, err := testSites(t, testSiteConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withSites(t, table)
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		site     string
+		notFound bool
+	}{
+		{"authority", siteContext("wizards.example:10000"), "wizards", false},
+		{"key wins over authority", siteContext("wizards.example", "site", "docs"), "docs", false},
+		{"unknown key", siteContext("wizards.example", "site", "nope"), "", true},
+		{"unknown authority falls back", siteContext("other.example"), "docs", false},
+		{"no metadata falls back", context.Background(), "docs", false},
+	}
+	for _, tt := range tests {
+		s, err := siteFor(tt.ctx)
+		var perr *pageError
+		if notFound := errors.As(err, &perr) && perr.kind == errKindNotFound; notFound != tt.notFound {
+			t.Errorf("%s: error = %v, want not found %v", tt.name, err, tt.notFound)
+			continue
+		}
+		if err == nil && s.name != tt.site {
+			t.Errorf("%s: site '%s', want '%s'", tt.name, s.name, tt.site)
+		}
+	}
+
+	// without a fallback unclaimed clients are turned away
+	table.fallback = nil
+	var perr *pageError
+	if _, err := siteFor(siteContext("other.example")); !errors.As(err, &perr) || perr.kind != errKindNotFound {
+		t.Errorf("unclaimed client without a fallback gave %v, want not found", err)
+	}
+
+	sites = nil
+	if s, err := siteFor(siteContext("other.example")); s != nil || err != nil {
+		t.Errorf("without sites got %v, %v, want the whole server", s, err)
+	}
+}
+
+// testSiteRegistry registers the pages of testSiteConfig, all listed
+func testSiteRegistry() *pageRegistry {
+	r := newPageRegistry()
+	for _, pattern := range []string{"wizards", "wizard/{id}", "about", "form", "docs/{rest...}"} {
+		r.register(&pageRoute{pattern: pattern, handler: func(ctx context.Context, preq *pb.PageRequest) (*pb.PageResponse, error) {
+			return &pb.PageResponse{Name: preq.Name}, nil
+		}, listed: !strings.Contains(pattern, "{")})
+	}
+	r.setDefault("form")
+	return r
+}
+
+func TestFeedFilterSite(t *testing.T) {
+	table, err := testSites(t, testSiteConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := testSiteRegistry()
+	wizards, _ := table.byName("wizards")
+	tests := []struct {
+		site *site
+		want []string
+	}{
+		{wizards, []string{"wizards"}},
+		{nil, []string{"about", "form", "wizards"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, listing := range r.listings(context.Background(), feedFilter{site: tt.site}) {
+			got = append(got, listing.Name)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("feed of site %v = %v, want %v", tt.site, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("feed of site %v = %v, want %v", tt.site, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestServePageSite(t *testing.T) {
+	table, err := testSites(t, testSiteConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withSites(t, table)
+	s := pageServer{registry: testSiteRegistry()}
+	tests := []struct {
+		authority string
+		page      string
+		want      string
+		notFound  bool
+	}{
+		// an empty name is the site's home, not the server's
+		{"wizards.example", "", "wizards", false},
+		{"docs.example", "", "about", false},
+		{"wizards.example", "wizard/abc", "wizard/abc", false},
+		{"wizards.example", "about", "", true},
+		{"docs.example", "wizard/abc", "", true},
+		// form is registered but no site serves it
+		{"docs.example", "form", "", true},
+	}
+	for _, tt := range tests {
+		presp, err := s.servePage(siteContext(tt.authority), &pb.PageRequest{Name: tt.page})
+		var perr *pageError
+		if notFound := errors.As(err, &perr) && perr.kind == errKindNotFound; notFound != tt.notFound {
+			t.Errorf("'%s' on %s: error = %v, want not found %v", tt.page, tt.authority, err, tt.notFound)
+			continue
+		}
+		if err == nil && presp.Name != tt.want {
+			t.Errorf("'%s' on %s served '%s', want '%s'", tt.page, tt.authority, presp.Name, tt.want)
+		}
+	}
+}
+
+// pageText returns the text of the page served to a client connected to authority
+func pageText(t *testing.T, s pageServer, authority, name string) (string, error) {
+	t.Helper()
+	presp, err := s.servePage(siteContext(authority), &pb.PageRequest{Name: name, ClientWidth: 80, ClientHeight: 24})
+	if err != nil {
+		return "", err
+	}
+	if presp.Elements == nil || len(presp.Elements.TextBlobs) == 0 {
+		return "", nil
+	}
+	return presp.Elements.TextBlobs[0].Content, nil
+}
+
+const testOwnSiteConfig = `
+sites:
+  - name: blue
+    hosts: [blue.example]
+    defaultPage: about
+    pageConfig: blue
+  - name: green
+    hosts: [green.example]
+    defaultPage: about
+    pages: [wizards]
+    pageConfig: green.yaml
+`
+
+// TestSitePageConfig checks that sites with their own page config each
+// serve their own page under the same name
+func TestSitePageConfig(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "blue"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(dir, "blue", "pages.yaml"), textPageConfig(map[string]string{"about": "blue about"}))
+	writeTestFile(t, filepath.Join(dir, "green.yaml"), textPageConfig(map[string]string{"about": "green about", "news": "green news"}))
+	registry := testSiteRegistry()
+	table, err := loadTestSites(t, dir, testOwnSiteConfig, registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withSites(t, table)
+	s := pageServer{registry: registry}
+	tests := []struct {
+		authority string
+		page      string
+		want      string
+		notFound  bool
+	}{
+		{"blue.example", "", "blue about", false},
+		{"blue.example", "about", "blue about", false},
+		{"green.example", "", "green about", false},
+		{"green.example", "news", "green news", false},
+		{"blue.example", "news", "", true},
+		// green serves wizards from the shared pages, blue doesn't
+		{"green.example", "wizards", "", false},
+		{"blue.example", "wizards", "", true},
+	}
+	for _, tt := range tests {
+		got, err := pageText(t, s, tt.authority, tt.page)
+		var perr *pageError
+		if notFound := errors.As(err, &perr) && perr.kind == errKindNotFound; notFound != tt.notFound {
+			t.Errorf("'%s' on %s: error = %v, want not found %v", tt.page, tt.authority, err, tt.notFound)
+			continue
+		}
+		if err == nil && got != tt.want {
+			t.Errorf("'%s' on %s = '%s', want '%s'", tt.page, tt.authority, got, tt.want)
+		}
+	}
+
+	green, _ := table.byName("green")
+	var feed []string
+	for _, listing := range green.listings(context.Background(), registry, feedFilter{site: green}) {
+		feed = append(feed, listing.Name)
+	}
+	if strings.Join(feed, ",") != "about,news,wizards" {
+		t.Errorf("feed of green = %v, want its own about and news and the shared wizards", feed)
+	}
+
+	// a reload that drops green's default page is rejected
+	writeTestFile(t, filepath.Join(dir, "green.yaml"), textPageConfig(map[string]string{"news": "green news"}))
+	if err := green.load(); err == nil {
+		t.Errorf("reload without green's default page was accepted")
+	}
+	if got, err := pageText(t, s, "green.example", "about"); err != nil || got != "green about" {
+		t.Errorf("after the rejected reload green's about = '%s', %v", got, err)
+	}
+}
+
+func TestSitePageConfigRejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		pages map[string]string
+		src   string
+	}{
+		{"default not in it", map[string]string{"news": "news"},
+			"sites:\n  - {name: a, defaultPage: about, pageConfig: own.yaml}\n"},
+		{"takes a shared name", map[string]string{"wizards": "mine", "about": "about"},
+			"sites:\n  - {name: a, defaultPage: about, pages: [wizards], pageConfig: own.yaml}\n"},
+		{"missing", nil, "sites:\n  - {name: a, defaultPage: about, pageConfig: missing.yaml}\n"},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		if tt.pages != nil {
+			writeTestFile(t, filepath.Join(dir, "own.yaml"), textPageConfig(tt.pages))
+		}
+		if _, err := loadTestSites(t, dir, tt.src, testSiteRegistry()); err == nil {
+			t.Errorf("%s: loaded", tt.name)
+		}
+	}
+}
+
+// TestSharedReloadKeepsSites checks that a reload of the shared page config
+// can't take away pages a site depends on
+func TestSharedReloadKeepsSites(t *testing.T) {
+	dir := t.TempDir()
+	config := filepath.Join(dir, "pages.yaml")
+	writeTestFile(t, config, textPageConfig(map[string]string{"news": "news", "news/today": "today"}))
+	registry := testSiteRegistry()
+	load := pageConfigLoader(registry, config, func(candidate *pageRegistry) error {
+		return sites.check(candidate)
+	})
+	if err := load(); err != nil {
+		t.Fatal(err)
+	}
+	table, err := loadTestSites(t, dir, "sites:\n  - {name: a, defaultPage: news, pages: [news, 'news/*']}\n", registry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withSites(t, table)
+	tests := []struct {
+		name    string
+		pages   map[string]string
+		wantErr bool
+	}{
+		{"changed text", map[string]string{"news": "more news", "news/today": "today"}, false},
+		{"default page gone", map[string]string{"news/today": "today"}, true},
+		{"glob matches nothing", map[string]string{"news": "news"}, true},
+	}
+	for _, tt := range tests {
+		writeTestFile(t, config, textPageConfig(tt.pages))
+		if err := load(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: reload error = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+	if _, _, ok := registry.lookup("news/today"); !ok {
+		t.Errorf("a rejected reload dropped news/today")
+	}
+}
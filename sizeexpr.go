@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// sizeExpr is a position or size in a page config. It is either a plain
+// number or an integer expression over the client's size such as
+// "width-10", "height/2" or "(width-40)/2" made of numbers, the variables
+// width and height, + - * / and parentheses. Division truncates like Go and
+// dividing by zero gives zero so a tiny client can't break a page. An
+// expression using template actions is rendered for every request first and
+// only parsed after that.
+type sizeExpr struct {
+	src  string
+	root sizeNode
+	tmpl *textTemplate
+}
+
+// sizeNode is a node of a parsed sizeExpr
+type sizeNode interface {
+	eval(width, height int) int
+}
+
+type sizeNum int
+
+func (n sizeNum) eval(width, height int) int { return int(n) }
+
+type sizeVar string
+
+func (v sizeVar) eval(width, height int) int {
+	if v == "width" {
+		return width
+	}
+	return height
+}
+
+type sizeOp struct {
+	op          byte
+	left, right sizeNode
+}
+
+func (o sizeOp) eval(width, height int) int {
+	l, r := o.left.eval(width, height), o.right.eval(width, height)
+	switch o.op {
+	case '+':
+		return l + r
+	case '-':
+		return l - r
+	case '*':
+		return l * r
+	}
+	if r == 0 {
+		return 0
+	}
+	return l / r
+}
+
+// eval computes the expression for the request data describes. The zero
+// sizeExpr is zero.
+func (e sizeExpr) eval(data *templateData) (int, error) {
+	if e.tmpl != nil {
+		src, err := e.tmpl.render(data)
+		if err != nil {
+			return 0, fmt.Errorf("size '%s': %w", e.src, err)
+		}
+		parsed, err := parseSizeExpr(src)
+		if err != nil {
+			return 0, fmt.Errorf("template '%s': %v", e.src, err)
+		}
+		e = parsed
+	}
+	if e.root == nil {
+		return 0, nil
+	}
+	return e.root.eval(data.Width, data.Height), nil
+}
+
+// String returns the expression as it was written
+func (e sizeExpr) String() string {
+	return e.src
+}
+
+// UnmarshalYAML accepts both numbers and expression strings
+func (e *sizeExpr) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var src string
+	if err := unmarshal(&src); err != nil {
+		return err
+	}
+	if strings.Contains(src, "{{") {
+		tmpl, err := parseTextTemplate(src)
+		if err != nil {
+			return err
+		}
+		*e = sizeExpr{src: src, tmpl: &tmpl}
+		return nil
+	}
+	parsed, err := parseSizeExpr(src)
+	if err != nil {
+		return err
+	}
+	*e = parsed
+	return nil
+}
+
+// parseSizeExpr parses the source of a sizeExpr
+func parseSizeExpr(src string) (sizeExpr, error) {
+	p := &sizeParser{src: src}
+	p.next()
+	root, err := p.sum()
+	if err != nil {
+		return sizeExpr{}, fmt.Errorf("size '%s': %v", src, err)
+	}
+	if p.tok != "" {
+		return sizeExpr{}, fmt.Errorf("size '%s': unexpected '%s'", src, p.tok)
+	}
+	return sizeExpr{src: src, root: root}, nil
+}
+
+// sizeParser is a recursive descent parser over the tokens of a sizeExpr.
+// tok is the current token and is empty at the end of the input.
+type sizeParser struct {
+	src string
+	pos int
+	tok string
+}
+
+// next advances tok to the next token
+func (p *sizeParser) next() {
+	for p.pos < len(p.src) && p.src[p.pos] == ' ' {
+		p.pos++
+	}
+	start := p.pos
+	switch {
+	case p.pos == len(p.src):
+	case unicode.IsDigit(rune(p.src[p.pos])):
+		for p.pos < len(p.src) && unicode.IsDigit(rune(p.src[p.pos])) {
+			p.pos++
+		}
+	case unicode.IsLetter(rune(p.src[p.pos])):
+		for p.pos < len(p.src) && unicode.IsLetter(rune(p.src[p.pos])) {
+			p.pos++
+		}
+	default:
+		p.pos++
+	}
+	p.tok = p.src[start:p.pos]
+}
+
+// sum parses terms joined by + and -
+func (p *sizeParser) sum() (sizeNode, error) {
+	left, err := p.product()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok == "+" || p.tok == "-" {
+		op := p.tok[0]
+		p.next()
+		right, err := p.product()
+		if err != nil {
+			return nil, err
+		}
+		left = sizeOp{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+// product parses factors joined by * and /
+func (p *sizeParser) product() (sizeNode, error) {
+	left, err := p.factor()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok == "*" || p.tok == "/" {
+		op := p.tok[0]
+		p.next()
+		right, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		left = sizeOp{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+// factor parses a number, a variable, a negation or a parenthesised sum
+func (p *sizeParser) factor() (sizeNode, error) {
+	tok := p.tok
+	switch {
+	case tok == "":
+		return nil, fmt.Errorf("unexpected end")
+	case tok == "(":
+		p.next()
+		inner, err := p.sum()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok != ")" {
+			return nil, fmt.Errorf("missing ')'")
+		}
+		p.next()
+		return inner, nil
+	case tok == "-":
+		p.next()
+		inner, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		return sizeOp{op: '-', left: sizeNum(0), right: inner}, nil
+	case tok == "width" || tok == "height":
+		p.next()
+		return sizeVar(tok), nil
+	case strings.IndexFunc(tok, func(r rune) bool { return !unicode.IsDigit(r) }) < 0:
+		n, err := strconv.Atoi(tok)
+		if err != nil {
+			return nil, err
+		}
+		p.next()
+		return sizeNum(n), nil
+	}
+	return nil, fmt.Errorf("unexpected '%s', only numbers, width and height are known", tok)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"gopkg.in/yaml.v2"
+	"testing"
+)
+
+func TestSizeExprEval(t *testing.T) {
+	tests := []struct {
+		src    string
+		width  int
+		height int
+		want   int
+	}{
+		{"0", 80, 24, 0},
+		{"42", 80, 24, 42},
+		{"width", 80, 24, 80},
+		{"height", 80, 24, 24},
+		{"width-10", 80, 24, 70},
+		{"height/2", 80, 24, 12},
+		{"(width-40)/2", 80, 24, 20},
+		// * and / bind tighter than + and -, all are left associative
+		{"2+3*4", 0, 0, 14},
+		{"(2+3)*4", 0, 0, 20},
+		{"10-4-3", 0, 0, 3},
+		{"100/10/5", 0, 0, 2},
+		{"width-height*2", 80, 24, 32},
+		{"width/3*3", 80, 24, 78},
+		// unary minus
+		{"-5", 0, 0, -5},
+		{"-width+100", 80, 24, 20},
+		{"--3", 0, 0, 3},
+		{"2*-3", 0, 0, -6},
+		{"-(width-90)", 80, 24, 10},
+		// division truncates towards zero and dividing by zero gives zero
+		{"7/2", 0, 0, 3},
+		{"-7/2", 0, 0, -3},
+		{"width/0", 80, 24, 0},
+		{"width/(height-24)", 80, 24, 0},
+		{"10/(width/100)", 80, 24, 0},
+		{" width - 10 ", 80, 24, 70},
+	}
+	for _, tt := range tests {
+		e, err := parseSizeExpr(tt.src)
+		if err != nil {
+			t.Errorf("parseSizeExpr('%s'): %v", tt.src, err)
+			continue
+		}
+		got, err := e.eval(&templateData{Width: tt.width, Height: tt.height})
+		if err != nil {
+			t.Errorf("'%s'.eval: %v", tt.src, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("'%s' at %dx%d = %d, want %d", tt.src, tt.width, tt.height, got, tt.want)
+		}
+	}
+}
+
+func TestSizeExprMalformed(t *testing.T) {
+	for _, src := range []string{
+		"",
+		"width-",
+		"*2",
+		"(width",
+		"width)",
+		"()",
+		"2 3",
+		"depth",
+		"width%2",
+		"1.5",
+		"99999999999999999999",
+	} {
+		if _, err := parseSizeExpr(src); err == nil {
+			t.Errorf("parseSizeExpr('%s') succeeded, want an error", src)
+		}
+	}
+}
+
+func TestSizeExprYAML(t *testing.T) {
+	tests := []struct {
+		src     string
+		want    int
+		wantErr bool
+	}{
+		{"12", 12, false},
+		{"width/4", 20, false},
+		{`"{{ .Height }}-4"`, 20, false},
+		{`"{{ if gt .Width 60 }}width{{ else }}10{{ end }}"`, 80, false},
+		{"width-", 0, true},
+		{`"{{ .Height"`, 0, true},
+	}
+	for _, tt := range tests {
+		var e sizeExpr
+		err := yaml.Unmarshal([]byte(tt.src), &e)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("unmarshal '%s' error = %v, want error %v", tt.src, err, tt.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		got, err := e.eval(&templateData{Width: 80, Height: 24})
+		if err != nil {
+			t.Errorf("'%s'.eval: %v", tt.src, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("'%s' = %d, want %d", tt.src, got, tt.want)
+		}
+	}
+}
+
+// TestSizeExprZero checks that a size left out of the config is zero
+func TestSizeExprZero(t *testing.T) {
+	var e sizeExpr
+	if got, err := e.eval(&templateData{Width: 80, Height: 24}); err != nil || got != 0 {
+		t.Errorf("zero sizeExpr = %d, %v, want 0", got, err)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	pb "github.com/rendicott/uggly"
+	"log"
+	"sort"
+	"strings"
+)
+
+// wizardRoute serves the detail page of a single wizard by its Id
+const wizardRoute = "wizard/{id}"
+
+// wizardIndex is the wizard data decoded from upstream along with the
+// lookups the wizard and elixir pages need. Elixirs only exist nested
+// inside the wizards that made them so the index also collects them into
+// a de-duplicated list and a reverse index of elixir Id to wizards.
+type wizardIndex struct {
+	wizards       []Wizard
+	wizardByID    map[string]*Wizard
+	elixirs       []*Elixer
+	elixirByID    map[string]*Elixer
+	elixirWizards map[string][]*Wizard
+}
+
+// newWizardIndex builds the lookups for a list of wizards. Elixirs are
+// sorted by name and the wizards of each elixir by their full name. Elixirs
+// without an Id can't have a page of their own so they are left out of the
+// elixir lookups, and logged, but still listed with their wizards.
+func newWizardIndex(wizards []Wizard) *wizardIndex {
+	index := &wizardIndex{
+		wizards:       wizards,
+		wizardByID:    make(map[string]*Wizard),
+		elixirByID:    make(map[string]*Elixer),
+		elixirWizards: make(map[string][]*Wizard),
+	}
+	skipped := 0
+	for i := range wizards {
+		wizard := &wizards[i]
+		index.wizardByID[wizard.Id] = wizard
+		for j := range wizard.Elixers {
+			elixir := &wizard.Elixers[j]
+			if elixir.Id == "" {
+				skipped++
+				continue
+			}
+			if _, seen := index.elixirByID[elixir.Id]; !seen {
+				index.elixirByID[elixir.Id] = elixir
+				index.elixirs = append(index.elixirs, elixir)
+			}
+			index.elixirWizards[elixir.Id] = append(index.elixirWizards[elixir.Id], wizard)
+		}
+	}
+	if skipped > 0 {
+		log.Printf("wizard data: %d elixirs without an id left out of the elixir pages", skipped)
+	}
+	sort.SliceStable(index.elixirs, func(i, j int) bool {
+		return index.elixirs[i].Name < index.elixirs[j].Name
+	})
+	for _, makers := range index.elixirWizards {
+		sort.SliceStable(makers, func(i, j int) bool {
+			return makers[i].fullName() < makers[j].fullName()
+		})
+	}
+	return index
+}
+
+// loadWizardIndex fetches the wizards and indexes them. Both the wizard and
+// the elixir pages go through here so the reverse index is built in one place
+// and, when the source is cached, only once per fetch.
+func loadWizardIndex(ctx context.Context) (*wizardIndex, error) {
+	if indexer, ok := wizardData.(wizardIndexer); ok {
+		index, err := indexer.Index(ctx)
+		if err != nil {
+			return nil, errUpstream(err, "The wizard data can't be loaded right now, try again in a bit.")
+		}
+		return index, nil
+	}
+	wizards, err := getWizards(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return newWizardIndex(wizards), nil
+}
+
+// fullName is how a wizard is shown in menus and headers
+func (w *Wizard) fullName() string {
+	return strings.TrimSpace(fmt.Sprintf("%s %s", w.FirstName, w.LastName))
+}
+
+// atLeast returns n unless it is smaller than min so that box geometry
+// computed from the client size never goes negative.
+func atLeast(n, min int) int {
+	if n < min {
+		return min
+	}
+	return n
+}
+
+// orUnknown fills in for the fields the Wizard World API leaves empty
+func orUnknown(s string) string {
+	if strings.TrimSpace(s) == "" {
+		return "unknown"
+	}
+	return s
+}
+
+// elixirDetails renders every decoded field of an elixir as an indented
+// block of text suitable for a TextBlob.
+func elixirDetails(elixir Elixer) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n", orUnknown(elixir.Name))
+	fmt.Fprintf(&b, "    Effect:          %s\n", orUnknown(elixir.Effect))
+	fmt.Fprintf(&b, "    Side effects:    %s\n", orUnknown(elixir.SideEffects))
+	fmt.Fprintf(&b, "    Characteristics: %s\n", orUnknown(elixir.Characteristics))
+	fmt.Fprintf(&b, "    Brewing time:    %s\n", orUnknown(elixir.Time))
+	fmt.Fprintf(&b, "    Manufacturer:    %s\n", orUnknown(elixir.Manufacturer))
+	return b.String()
+}
+
+// wizardDetail shows a wizard's name in a header box and every elixir they
+// are known for in a scrollable box below it. The page is sized to the
+// client and has keystrokes to scroll the elixirs and go back to the list.
+func wizardDetail(ctx context.Context, preq *pb.PageRequest) (presp *pb.PageResponse, err error) {
+	id := routeParam(ctx, "id")
+	index, err := loadWizardIndex(ctx)
+	if err != nil {
+		return presp, err
+	}
+	wizard, ok := index.wizardByID[id]
+	if !ok {
+		return nil, errNotFound("There is no wizard with the id '%s'.", id)
+	}
+	content := fmt.Sprintf("ELIXIRS (%d)\n\n", len(wizard.Elixers))
+	if len(wizard.Elixers) == 0 {
+		content += "This wizard isn't known for any elixirs.\n"
+	}
+	for _, elixir := range wizard.Elixers {
+		content += elixirDetails(elixir) + "\n"
+	}
+	return detailPage(preq, wizard.fullName(), "wizards", "back to wizards", content), err
+}
+
+// detailPageKeys are the keystrokes detailPage uses itself
+var detailPageKeys = []string{"b", "j", "k"}
+
+// detailPage lays out the pages that show a single wizard or elixir: a
+// header box with the title and the available keystrokes and a bordered
+// body box below it sized to the client. The body can be scrolled with j
+// and k and b goes back to the page named by back.
+func detailPage(preq *pb.PageRequest, title, back, backLabel, body string) *pb.PageResponse {
+	height := int(preq.ClientHeight)
+	width := int(preq.ClientWidth)
+	localPage := pb.PageResponse{
+		Name:     preq.Name,
+		DivBoxes: &pb.DivBoxes{},
+		Elements: &pb.Elements{},
+	}
+	localPage.DivBoxes.Boxes = append(localPage.DivBoxes.Boxes, &pb.DivBox{
+		Name:       "detail-header",
+		Border:     true,
+		BorderW:    int32(1),
+		BorderChar: convertStringCharRune("="),
+		FillChar:   convertStringCharRune(""),
+		StartX:     2,
+		StartY:     1,
+		Width:      int32(atLeast(width-4, 1)),
+		Height:     int32(5),
+		BorderSt:   shelp("orange", "black"),
+		FillSt:     shelp("white", "black"),
+	})
+	localPage.DivBoxes.Boxes = append(localPage.DivBoxes.Boxes, &pb.DivBox{
+		Name:       "detail-body",
+		Border:     true,
+		BorderW:    int32(1),
+		BorderChar: convertStringCharRune("^"),
+		FillChar:   convertStringCharRune(""),
+		StartX:     2,
+		StartY:     7,
+		Width:      int32(atLeast(width-4, 1)),
+		Height:     int32(atLeast(height-8, 1)),
+		BorderSt:   shelp("grey", "black"),
+		FillSt:     shelp("white", "black"),
+	})
+	header := fmt.Sprintf("%s\n(b) %s   (j) scroll down   (k) scroll up", title, backLabel)
+	localPage.Elements.TextBlobs = append(localPage.Elements.TextBlobs, &pb.TextBlob{
+		Content:  header,
+		Wrap:     true,
+		Style:    shelp("white", "black"),
+		DivNames: []string{"detail-header"},
+	})
+	localPage.Elements.TextBlobs = append(localPage.Elements.TextBlobs, &pb.TextBlob{
+		Content:  body,
+		Wrap:     true,
+		Style:    shelp("white", "black"),
+		DivNames: []string{"detail-body"},
+	})
+	localPage.KeyStrokes = append(localPage.KeyStrokes, &pb.KeyStroke{
+		KeyStroke: "b",
+		Action: &pb.KeyStroke_Link{
+			Link: localLink(back),
+		}})
+	localPage.KeyStrokes = append(localPage.KeyStrokes, &pb.KeyStroke{
+		KeyStroke: "j",
+		Action: &pb.KeyStroke_DivScroll{
+			DivScroll: &pb.DivScroll{
+				DivName: "detail-body",
+				Down:    true,
+			}}})
+	localPage.KeyStrokes = append(localPage.KeyStrokes, &pb.KeyStroke{
+		KeyStroke: "k",
+		Action: &pb.KeyStroke_DivScroll{
+			DivScroll: &pb.DivScroll{
+				DivName: "detail-body",
+				Down:    false,
+			}}})
+	return &localPage
+}
+
+func init() {
+	pages.register(&pageRoute{pattern: wizardRoute, handler: wizardDetail, minWidth: 40, minHeight: 12})
+}
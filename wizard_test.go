@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	pb "github.com/rendicott/uggly"
+	"strings"
+	"testing"
+)
+
+// testWizards has two wizards sharing an elixir and an elixir without an Id
+func testWizards() []Wizard {
+	return []Wizard{
+		{Id: "w1", FirstName: "Newt", LastName: "Scamander", Elixers: []Elixer{
+			{Id: "e1", Name: "Felix Felicis"},
+			{Id: "", Name: "Nameless Draught"},
+		}},
+		{Id: "w2", FirstName: "Albus", LastName: "Dumbledore", Elixers: []Elixer{
+			{Id: "e1", Name: "Felix Felicis"},
+			{Id: "e2", Name: "Amortentia"},
+		}},
+	}
+}
+
+func TestNewWizardIndex(t *testing.T) {
+	index := newWizardIndex(testWizards())
+	var names []string
+	for _, elixir := range index.elixirs {
+		names = append(names, elixir.Name)
+	}
+	if got, want := strings.Join(names, ","), "Amortentia,Felix Felicis"; got != want {
+		t.Errorf("elixirs %s, want %s", got, want)
+	}
+	if _, ok := index.elixirByID[""]; ok {
+		t.Errorf("elixir without an id was indexed")
+	}
+	makers := index.elixirWizards["e1"]
+	if len(makers) != 2 || makers[0].Id != "w2" || makers[1].Id != "w1" {
+		t.Errorf("wizards of e1 %v, want w2 and w1 by full name", makers)
+	}
+}
+
+// TestElixirsSkipsMissingID checks that an elixir without an Id doesn't
+// take the elixir index page down
+func TestElixirsSkipsMissingID(t *testing.T) {
+	saved := wizardData
+	defer func() { wizardData = saved }()
+	wizardData = staticWizards(testWizards())
+	presp, err := elixirs(context.Background(), &pb.PageRequest{Name: "elixirs", ClientWidth: 80, ClientHeight: 24})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content := presp.Elements.TextBlobs[0].Content; !strings.HasPrefix(content, "ELIXIRS (2)") {
+		t.Errorf("elixir index starts with '%s', want 'ELIXIRS (2)'", strings.SplitN(content, "\n", 2)[0])
+	}
+}
+
+// staticWizards is a wizard source that always has the same wizards
+type staticWizards []Wizard
+
+func (s staticWizards) Wizards(ctx context.Context) ([]Wizard, error) {
+	return s, nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// wizardIndexer is implemented by wizard sources that can hand out an
+// already built wizardIndex instead of having it rebuilt on every request.
+type wizardIndexer interface {
+	Index(ctx context.Context) (*wizardIndex, error)
+}
+
+// cachedWizardSource keeps the last list of wizards fetched from another
+// source in memory for ttl. Once the list expires it is either served stale
+// while a background refresh runs or, if serveStale is off, refetched before
+// the request is answered.
+type cachedWizardSource struct {
+	source     wizardSource
+	ttl        time.Duration
+	serveStale bool
+
+	fetchMu    sync.Mutex
+	mu         sync.RWMutex
+	index      *wizardIndex
+	fetched    time.Time
+	refreshing bool
+	lastErr    error
+}
+
+func newCachedWizardSource(source wizardSource, ttl time.Duration, serveStale bool) *cachedWizardSource {
+	return &cachedWizardSource{
+		source:     source,
+		ttl:        ttl,
+		serveStale: serveStale,
+	}
+}
+
+// Wizards returns the cached wizards, fetching them first if needed
+func (c *cachedWizardSource) Wizards(ctx context.Context) ([]Wizard, error) {
+	index, err := c.Index(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return index.wizards, nil
+}
+
+// Index returns the cached wizardIndex. A fresh index is returned as is. An
+// expired one is returned right away with a refresh started in the
+// background when serving stale data is allowed, otherwise it is refetched
+// within the deadline of ctx. If that refetch fails the expired index is
+// still served when allowed so an upstream outage doesn't take pages down.
+func (c *cachedWizardSource) Index(ctx context.Context) (*wizardIndex, error) {
+	c.mu.RLock()
+	index, fetched := c.index, c.fetched
+	c.mu.RUnlock()
+	if index != nil && time.Since(fetched) < c.ttl {
+		return index, nil
+	}
+	if index != nil && c.serveStale {
+		c.refreshInBackground()
+		return index, nil
+	}
+	c.fetchMu.Lock()
+	defer c.fetchMu.Unlock()
+	// another request may have refreshed while this one waited for the lock
+	c.mu.RLock()
+	index, fetched = c.index, c.fetched
+	c.mu.RUnlock()
+	if index != nil && time.Since(fetched) < c.ttl {
+		return index, nil
+	}
+	fresh, err := c.fetch(ctx)
+	if err != nil {
+		if index != nil && c.serveStale {
+			log.Printf("serving wizards from %s ago, refresh failed: %v",
+				time.Since(fetched).Round(time.Second), err)
+			return index, nil
+		}
+		return nil, err
+	}
+	return fresh, nil
+}
+
+// healthCheck goes through the cache, refreshing it if it has expired, and
+// reports the outcome of the last call to the wrapped source. An upstream
+// that is down makes this unhealthy even while stale data is being served.
+func (c *cachedWizardSource) healthCheck(ctx context.Context) error {
+	if _, err := c.Index(ctx); err != nil {
+		return err
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.lastErr
+}
+
+// refreshInBackground starts a refresh unless one is already running. The
+// refresh outlives the request that triggered it so it gets its own context
+// and relies on the wrapped source to put a deadline on it.
+func (c *cachedWizardSource) refreshInBackground() {
+	c.mu.Lock()
+	if c.refreshing {
+		c.mu.Unlock()
+		return
+	}
+	c.refreshing = true
+	c.mu.Unlock()
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			c.refreshing = false
+			c.mu.Unlock()
+		}()
+		c.fetchMu.Lock()
+		defer c.fetchMu.Unlock()
+		if _, err := c.fetch(context.Background()); err != nil {
+			log.Printf("background wizard refresh failed: %v", err)
+		}
+	}()
+}
+
+// fetch calls the wrapped source and stores the result. The caller must
+// hold fetchMu.
+func (c *cachedWizardSource) fetch(ctx context.Context) (*wizardIndex, error) {
+	wizards, err := c.source.Wizards(ctx)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastErr = err
+	if err != nil {
+		return nil, err
+	}
+	c.index = newWizardIndex(wizards)
+	c.fetched = time.Now()
+	return c.index, nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type Elixer struct {
+	Id              string `json:"id"`
+	Name            string `json:"name"`
+	Effect          string `json:"effect"`
+	SideEffects     string `json:"sideEffects"`
+	Characteristics string `json:"characteristics"`
+	Time            string `json:"time"`
+	Manufacturer    string `json:"manufacturer"`
+}
+
+type Wizard struct {
+	Elixers   []Elixer `json:"elixirs"`
+	Id        string   `json:"id"`
+	FirstName string   `json:"firstName"`
+	LastName  string   `json:"lastName"`
+}
+
+// wizardSource is anything the wizard and elixir pages can get their list
+// of wizards from.
+type wizardSource interface {
+	Wizards(ctx context.Context) ([]Wizard, error)
+}
+
+// wizardData is the source picked with the -wizard_source flag
+var wizardData wizardSource
+
+// newWizardSource builds the wizard source named by kind
+func newWizardSource(kind, baseURL, fixture string, timeout time.Duration) (wizardSource, error) {
+	switch kind {
+	case "http":
+		return newHTTPWizardSource(baseURL, timeout), nil
+	case "file":
+		return newFileWizardSource(fixture)
+	default:
+		return nil, fmt.Errorf("unknown wizard source '%s', want 'http' or 'file'", kind)
+	}
+}
+
+// getWizards returns the wizards from whichever source the server was started
+// with. Any failure of the source is reported to the client as an upstream error.
+func getWizards(ctx context.Context) (wizards []Wizard, err error) {
+	wizards, err = wizardData.Wizards(ctx)
+	if err != nil {
+		return nil, errUpstream(err, "The wizard data can't be loaded right now, try again in a bit.")
+	}
+	return wizards, nil
+}
+
+// httpWizardSource reads wizards from a Wizard World API compatible server.
+// Every call is bounded by timeout on top of whatever deadline ctx has.
+type httpWizardSource struct {
+	baseURL string
+	timeout time.Duration
+	client  *http.Client
+}
+
+func newHTTPWizardSource(baseURL string, timeout time.Duration) *httpWizardSource {
+	return &httpWizardSource{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		timeout: timeout,
+		client:  http.DefaultClient,
+	}
+}
+
+// Wizards fetches the /Wizards endpoint of the configured API
+func (h *httpWizardSource) Wizards(ctx context.Context) (wizards []Wizard, err error) {
+	if h.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, h.baseURL+"/Wizards", nil)
+	if err != nil {
+		return wizards, err
+	}
+	response, err := h.client.Do(request)
+	if err != nil {
+		return wizards, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return wizards, fmt.Errorf("wizard API responded with '%s'", response.Status)
+	}
+	responseData, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return wizards, err
+	}
+	err = json.Unmarshal(responseData, &wizards)
+	return wizards, err
+}
+
+// healthCheck probes the API with a HEAD request so checking doesn't
+// download the whole wizard list. Any answer short of a server error means
+// the API is up, some servers don't route HEAD and answer 405.
+func (h *httpWizardSource) healthCheck(ctx context.Context) error {
+	if h.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodHead, h.baseURL+"/Wizards", nil)
+	if err != nil {
+		return err
+	}
+	response, err := h.client.Do(request)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("wizard API responded with '%s'", response.Status)
+	}
+	return nil
+}
+
+// fileWizardSource reads wizards from a local JSON fixture in the same
+// format the Wizard World API returns so the server can run offline.
+type fileWizardSource struct {
+	path string
+}
+
+// newFileWizardSource checks that the fixture can be decoded up front so a
+// bad path fails at startup instead of on the first page request.
+func newFileWizardSource(path string) (*fileWizardSource, error) {
+	f := &fileWizardSource{path: path}
+	if _, err := f.Wizards(context.Background()); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Wizards re-reads the fixture on every call so it can be edited while the
+// server is running.
+func (f *fileWizardSource) Wizards(ctx context.Context) (wizards []Wizard, err error) {
+	data, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return wizards, err
+	}
+	if err = json.Unmarshal(data, &wizards); err != nil {
+		return wizards, fmt.Errorf("decoding wizard fixture '%s': %v", f.path, err)
+	}
+	return wizards, err
+}